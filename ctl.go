@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gohxs/cloudmount/internal/core"
+)
+
+// ctlCommands control commands, request path and method
+var ctlCommands = map[string]struct {
+	path string
+	post bool
+	desc string
+}{
+	"refresh":    {"/refresh", true, "check for changes now ('refresh full' reloads the listing)"},
+	"flush":      {"/flush", true, "upload changed files with open handles"},
+	"drop-cache": {"/drop-cache", true, "drop local copies of open files without changes"},
+	"handles":    {"/handles", false, "list open file handles"},
+	"transfers":  {"/transfers", false, "list running uploads and downloads"},
+	"stats":      {"/stats", false, "show mount stats"},
+	"verbose":    {"/verbose", true, "set log verbosity: verbose <0|1|2>"},
+}
+
+// ctl talks to a running mount through its control socket:
+//   cloudmount ctl [-w workdir] <directory> <command> [arg]
+func ctl(config *core.Config, args []string) int {
+	fset := flag.NewFlagSet("ctl", flag.ExitOnError)
+	fset.StringVar(&config.HomeDir, "w", config.HomeDir, "Work dir, path that holds configurations")
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s ctl [options] <directory> <command> [arg]\n\n", os.Args[0])
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nCommands:\n")
+		names := []string{}
+		for name := range ctlCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, ctlCommands[name].desc)
+		}
+	}
+	fset.Parse(args)
+	if fset.NArg() < 2 {
+		fset.Usage()
+		return 2
+	}
+	config.Target = fset.Arg(0)
+	cmd, ok := ctlCommands[fset.Arg(1)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "ERR: unknown command '%s'\n", fset.Arg(1))
+		fset.Usage()
+		return 2
+	}
+	form := url.Values{}
+	switch arg := fset.Arg(2); fset.Arg(1) {
+	case "refresh":
+		form.Set("full", fmt.Sprint(arg == "full"))
+	case "verbose":
+		form.Set("level", arg)
+	}
+
+	sock := config.MountFile(".sock")
+	client := &http.Client{
+		Timeout: 5 * time.Minute, // flush might take long
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+	var res *http.Response
+	var err error
+	if cmd.post {
+		res, err = client.PostForm("http://cloudmount"+cmd.path, form)
+	} else {
+		res, err = client.Get("http://cloudmount" + cmd.path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERR: %s not mounted or not reachable: %v\n", config.Target, err)
+		return 1
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "ERR: %s", body)
+		return 1
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err == nil {
+		if s, ok := v.(string); ok {
+			fmt.Println(s)
+			return 0
+		}
+	}
+	out := bytes.Buffer{}
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		os.Stdout.Write(body)
+		return 0
+	}
+	fmt.Print(out.String())
+	return 0
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/gohxs/cloudmount/internal/core"
+	"github.com/gohxs/cloudmount/internal/coreutil"
+)
+
+// daemon starts cloudmount in background detached from the terminal and
+// waits until it reports the mount result, returns the exit code
+func daemon(config *core.Config) int {
+	pidFile, logFile := config.MountFile(".pid"), config.MountFile(".log")
+	if err := os.MkdirAll(config.HomeDir, 0700); err != nil {
+		fmt.Fprintln(os.Stderr, "ERR:", err)
+		return 1
+	}
+	logf, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERR: log file:", err)
+		return 1
+	}
+	defer logf.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERR:", err)
+		return 1
+	}
+	defer r.Close()
+
+	subArgs := []string{"-f"}
+	for _, arg := range cmdArgs {
+		if arg == "-f" { // ignore daemon flag, already added
+			continue
+		}
+		subArgs = append(subArgs, arg)
+	}
+	cmd := exec.Command(os.Args[0], subArgs...)
+	cmd.Stdout = logf
+	cmd.Stderr = logf
+	cmd.ExtraFiles = []*os.File{w} // fd 3
+	cmd.Env = append(os.Environ(), coreutil.ReadyEnv+"=3", core.PidFileEnv+"="+pidFile)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if pass, ok := coreutil.Passphrase(); ok { // Asked in the terminal, the daemon has none
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			w.Close()
+			fmt.Fprintln(os.Stderr, "ERR:", err)
+			return 1
+		}
+		pw.WriteString(pass)
+		pw.Close()
+		defer pr.Close()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, pr) // fd 4
+		cmd.Env = append(cmd.Env, coreutil.PassphraseFDEnv+"=4")
+	}
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		fmt.Fprintln(os.Stderr, "ERR: starting daemon:", err)
+		return 1
+	}
+	w.Close() // Only the daemon writes
+
+	msg, _ := bufio.NewReader(r).ReadString('\n')
+	msg = strings.TrimSpace(msg)
+	switch {
+	case msg == "OK":
+		cmd.Process.Release()
+		fmt.Println("[PID]", cmd.Process.Pid)
+		return 0
+	case strings.HasPrefix(msg, "ERR "):
+		fmt.Fprintln(os.Stderr, "ERR:", strings.TrimPrefix(msg, "ERR "))
+		cmd.Wait()
+		return 1
+	}
+	// Exited without reporting
+	cmd.Wait()
+	fmt.Fprintf(os.Stderr, "ERR: daemon exited (%v), see %s\n", cmd.ProcessState, logFile)
+	if code := cmd.ProcessState.ExitCode(); code > 0 {
+		return code
+	}
+	return 1
+}
@@ -7,11 +7,15 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/gohxs/cloudmount/internal/core"
 	"github.com/gohxs/cloudmount/internal/coreutil"
 )
 
+// cmdArgs command line arguments in cloudmount form, used to start the daemon
+var cmdArgs []string
+
 func parseFlags(config *core.Config) (err error) {
 	var mountoptsFlag string
 
@@ -22,19 +26,46 @@ func parseFlags(config *core.Config) (err error) {
 	flag.StringVar(&config.HomeDir, "w", config.HomeDir, "Work dir, path that holds configurations")
 	flag.DurationVar(&config.RefreshTime, "r", config.RefreshTime, "Timed cloud synchronization interval [if applied]")
 
-	flag.StringVar(&mountoptsFlag, "o", "", fmt.Sprintf("%v", config.Options))
+	// Common and driver namespaced mount options
+	optionSet := coreutil.OptionSet{"": &config.Options}
+	for driver, opts := range config.DriverOptions {
+		optionSet[driver] = opts
+	}
+	flag.StringVar(&mountoptsFlag, "o", "", "Mount options key=value separated by ',' (see Mount options)")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "\n")
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] [<source>] <directory>\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Source: can be json/yaml configuration file usually with credentials or cloud specific configuration\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [<source>] <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s systemd-unit [-mount] [-o options] <source> <directory>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s ctl [-w workdir] <directory> <command> [arg]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Source: can be json/yaml configuration file usually with credentials or cloud specific configuration\n")
+		fmt.Fprintf(os.Stderr, "        or a remote name in <workdir>/config.yaml followed by ':' (i.e: work-drive:)\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\n")
+		fmt.Fprintf(os.Stderr, "Mount options (lists are separated by '%s'):\n", coreutil.ListSeparator)
+		fmt.Fprintf(os.Stderr, "%s\n", optionSet.Usage())
+		fmt.Fprintf(os.Stderr, "Other options are passed to FUSE and the kernel (i.e: %s)\n", strings.Join(coreutil.FuseOptions, ","))
+	}
+
+	cmdArgs = os.Args[1:]
+	name := filepath.Base(os.Args[0])
+	if strings.HasPrefix(name, "mount.") { // Called by mount(8) or from fstab
+		name = strings.TrimPrefix(name, "mount.")
+		if len(cmdArgs) > 0 && !strings.HasPrefix(cmdArgs[0], "-") {
+			var fake bool
+			cmdArgs, fake, err = mountHelperArgs(cmdArgs)
+			if err != nil {
+				log.Fatalf("ERR: %v", err)
+			}
+			if fake {
+				os.Exit(0)
+			}
+		}
 	}
-	flag.Parse()
+	flag.CommandLine.Parse(cmdArgs)
 
-	fileExt := filepath.Ext(os.Args[0])
+	fileExt := filepath.Ext(name)
 	if fileExt != "" {
 		if config.Type != "" {
 			log.Fatal("Cannot specify -t when type is specified in executable name")
@@ -54,16 +85,35 @@ func parseFlags(config *core.Config) (err error) {
 		config.Source = flag.Arg(0)
 		config.Target = flag.Arg(1)
 	}
+	if abs, err := filepath.Abs(config.Target); err == nil { // Symlinks are resolved against it
+		config.Target = abs
+	}
+	// Named remote in unified config (i.e: cloudmount work-drive: /mnt/work)
+	if remote := strings.TrimSuffix(config.Source, ":"); remote != config.Source {
+		if _, err := os.Stat(config.Source); os.IsNotExist(err) {
+			config.Source = filepath.Join(config.HomeDir, "config.yaml") + "#" + remote
+		}
+	}
 
 	if config.Verbose2Log {
 		config.VerboseLog = true
 	}
 
-	// Read fs type from config file
+	// Read fs type and common settings from config file
 	sourceType := struct {
-		Type string `json:"type"`
+		Type         string `json:"type"`
+		Root         string `json:"root"`
+		MountOptions string `json:"mount_options" yaml:"mount_options"`
 	}{}
-	coreutil.ParseConfig(config.Source, &sourceType)
+	if err := coreutil.ParseConfigKeys(config.Source, &sourceType); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("ERR: %v", err)
+	}
+	config.Options.Root = sourceType.Root // -o root= overrides
+	if sourceType.MountOptions != "" {
+		if err := coreutil.ParseMountOptions(sourceType.MountOptions, optionSet, config.FuseOptions); err != nil {
+			log.Fatalf("ERR: mount_options in <source>: %v", err)
+		}
+	}
 	if sourceType.Type != "" {
 		if config.Type != "" && sourceType.Type != config.Type {
 			log.Fatalf("ERR: service mismatch <source> specifies '%s' while flag -t is '%s'", sourceType.Type, config.Type)
@@ -75,9 +125,10 @@ func parseFlags(config *core.Config) (err error) {
 		log.Fatalf("ERR: Missing -t param, unknown file system")
 	}
 
-	err = coreutil.ParseOptions(mountoptsFlag, &config.Options)
+	config.MountOptions = mountoptsFlag
+	err = coreutil.ParseMountOptions(mountoptsFlag, optionSet, config.FuseOptions)
 	if err != nil {
-		log.Fatal("ERR: Invalid syntax parsing mount options")
+		log.Fatalf("ERR: %v", err)
 	}
 	return
 }
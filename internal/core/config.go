@@ -1,6 +1,7 @@
 package core
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/gohxs/cloudmount/internal/coreutil"
@@ -16,17 +17,45 @@ type Config struct {
 	HomeDir     string
 	Target      string // should be a folder
 	Source      string
+	PidFile     string // Written once mounted, removed on unmount
 
 	//Options map[string]string
 	Options Options
+	// Driver specific options by driver type, set with -o <type>.<name>=value
+	DriverOptions map[string]interface{}
+	// Generic FUSE options passed to the kernel (i.e: allow_other)
+	FuseOptions map[string]string
+	// -o flag, applied again after <source> mount_options on reload
+	MountOptions string
+}
+
+// Refresh interval to check for changes, changes on reload
+func (c *Config) Refresh() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&c.RefreshTime)))
+}
+
+// SetRefresh sets the interval to check for changes while mounted
+func (c *Config) SetRefresh(d time.Duration) {
+	atomic.StoreInt64((*int64)(&c.RefreshTime), int64(d))
 }
 
 // Options are specified in cloudmount -o option1=1, option2=2
 type Options struct { // are Options for specific driver?
 	// Sub options
-	UID      uint32 `opt:"uid"`
-	GID      uint32 `opt:"gid"` // Mount GID
-	Readonly bool   `opt:"ro"`
+	UID      uint32 `opt:"uid" desc:"Owner of files"`
+	GID      uint32 `opt:"gid" desc:"Group of files"` // Mount GID
+	Readonly bool   `opt:"ro" desc:"Mount read only"`
+	Trash    bool   `opt:"trash" desc:"Delete to service trash if supported"`
+	Root     string `opt:"root" desc:"Cloud folder path or ID to be used as mount root"`
+	// Filename handling for names linux can't represent
+	NameEncoding string `opt:"encoding" enum:"unicode,underscore" desc:"Encoding of invalid chars in names"`
+	LongNames    string `opt:"longnames" enum:"hash,truncate" desc:"Shortening of names over 255 bytes"`
+	// Applied while mounted on reload (SIGHUP)
+	Refresh   time.Duration `opt:"refresh" desc:"Interval to check for cloud changes (as -r)"`
+	Verbose   int           `opt:"verbose" enum:"0,1,2" desc:"Log verbosity (as -v, -vv)"`
+	RateLimit float64       `opt:"rate_limit" desc:"Max cloud requests per second, 0 for no limit"`
+	// Wait for pending uploads on unmount
+	StopTimeout time.Duration `opt:"stop_timeout" desc:"Time to wait for pending uploads on unmount"`
 }
 
 func (o Options) String() string {
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gohxs/cloudmount/internal/coreutil"
+)
+
+// Controller optional DriverFS operations exposed on the control socket
+type Controller interface {
+	RefreshNow(full bool) error // Check for changes now, full reloads the listing
+	Flush() error               // Upload changed files with open handles
+	DropCache() int             // Drop local copies not pending upload
+	Handles() []HandleInfo      // Open file handles
+	Transfers() []Transfer      // Running uploads and downloads
+	Stats() map[string]int      // Counters
+}
+
+// HandleInfo open file handle
+type HandleInfo struct {
+	ID     uint64 `json:"id"`
+	Path   string `json:"path"`
+	Cached bool   `json:"cached"` // Has a local copy
+	Dirty  bool   `json:"dirty"`  // Pending upload
+}
+
+// Transfer running upload or download
+type Transfer struct {
+	Path    string    `json:"path"`
+	Upload  bool      `json:"upload"`
+	Started time.Time `json:"started"`
+}
+
+// MountFile file for the mount in the work dir named after the escaped
+// target (i.e: /mnt/gdrive -> $HOME/.cloudmount/mnt-gdrive.sock,
+// /mnt/a-b -> mnt-a\x2db.sock)
+func (c *Config) MountFile(ext string) string {
+	target := c.Target
+	if abs, err := filepath.Abs(target); err == nil {
+		target = abs
+	}
+	return filepath.Join(c.HomeDir, coreutil.EscapePath(target)+ext)
+}
+
+// serveControl listens on the mount control socket, returns the listener
+// to be closed on unmount
+func (c *Core) serveControl() (net.Listener, error) {
+	ctl, ok := c.CurrentFS.(Controller)
+	if !ok {
+		return nil, fmt.Errorf("%s does not support control", c.Config.Type)
+	}
+	sock := c.Config.MountFile(".sock")
+	if conn, err := net.Dial("unix", sock); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s in use", sock)
+	}
+	os.Remove(sock) // Stale
+	// Created private, not accessible by others until chmod
+	mask := syscall.Umask(0077)
+	l, err := net.Listen("unix", sock)
+	syscall.Umask(mask)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(sock, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	started := time.Now()
+	mux := http.NewServeMux()
+	ok200 := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	post := func(fn http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "use POST", http.StatusMethodNotAllowed)
+				return
+			}
+			fn(w, r)
+		}
+	}
+
+	mux.HandleFunc("/refresh", post(func(w http.ResponseWriter, r *http.Request) {
+		if err := ctl.RefreshNow(r.FormValue("full") == "true"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ok200(w, "refreshed")
+	}))
+	mux.HandleFunc("/flush", post(func(w http.ResponseWriter, r *http.Request) {
+		if err := ctl.Flush(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ok200(w, "flushed")
+	}))
+	mux.HandleFunc("/drop-cache", post(func(w http.ResponseWriter, r *http.Request) {
+		ok200(w, fmt.Sprintf("%d files dropped", ctl.DropCache()))
+	}))
+	mux.HandleFunc("/handles", func(w http.ResponseWriter, r *http.Request) {
+		ok200(w, ctl.Handles())
+	})
+	mux.HandleFunc("/transfers", func(w http.ResponseWriter, r *http.Request) {
+		ok200(w, ctl.Transfers())
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		mem := runtime.MemStats{}
+		runtime.ReadMemStats(&mem)
+		ok200(w, map[string]interface{}{
+			"type":       c.Config.Type,
+			"source":     c.Config.Source,
+			"target":     c.Config.Target,
+			"pid":        os.Getpid(),
+			"uptime":     time.Since(started).Round(time.Second).String(),
+			"mem_alloc":  fmt.Sprintf("%.2fMB", float64(mem.Alloc)/1024/1024),
+			"goroutines": runtime.NumGoroutine(),
+			"verbose":    coreutil.Verbose(),
+			"fs":         ctl.Stats(),
+		})
+	})
+	mux.HandleFunc("/verbose", post(func(w http.ResponseWriter, r *http.Request) {
+		level, err := strconv.Atoi(r.FormValue("level"))
+		if err != nil || level < 0 || level > 2 {
+			http.Error(w, "level must be 0, 1 or 2", http.StatusBadRequest)
+			return
+		}
+		coreutil.SetVerbose(level)
+		ok200(w, fmt.Sprintf("verbose %d", level))
+	}))
+
+	go http.Serve(l, mux)
+	return l, nil
+}
@@ -3,12 +3,14 @@ package core
 import (
 	"context"
 	"flag"
-	glog "log"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"os/user"
 	"path/filepath"
-	"runtime"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -20,16 +22,24 @@ import (
 
 var (
 	pname  = "cloudmount"
-	log    = prettylog.Dummy()
+	log    = coreutil.VerboseLogger(pname, 1)
 	errlog = prettylog.New(pname + "-err")
+	// Always shown
+	infolog = prettylog.New(pname)
 )
 
+// PidFileEnv pidfile to be written by a daemon
+const PidFileEnv = "CLOUDMOUNT_PIDFILE"
+
 // Core struct
 type Core struct {
 	Config  Config
 	Drivers map[string]DriverFactory
 
 	CurrentFS DriverFS
+
+	defaults    Options       // Before flags, base options on reload
+	refreshFlag time.Duration // -r, used when there is no refresh option
 }
 
 // New create a New cloudmount core
@@ -51,7 +61,7 @@ func New() *Core {
 		panic(err)
 	}
 
-	return &Core{
+	c := &Core{
 		Drivers: map[string]DriverFactory{},
 		Config: Config{
 			Foreground:  false,
@@ -60,24 +70,32 @@ func New() *Core {
 			RefreshTime: 5 * time.Second,
 			HomeDir:     filepath.Join(usr.HomeDir, ".cloudmount"),
 			Source:      filepath.Join(usr.HomeDir, ".cloudmount", "gdrive.yaml"),
+			PidFile:     os.Getenv(PidFileEnv),
 
 			// Defaults at least
 			Options: Options{
 				UID:      uint32(uid),
 				GID:      uint32(gid),
 				Readonly: false,
+				Trash:    true,
+
+				NameEncoding: "unicode",
+				LongNames:    "hash",
+				StopTimeout:  30 * time.Second,
 			},
+			DriverOptions: map[string]interface{}{},
+			FuseOptions:   map[string]string{},
 		},
 	}
+	c.defaults = c.Config.Options
+	return c
 
 }
 
 // Init to be run after configuration
 func (c *Core) Init() (err error) {
-
-	if c.Config.VerboseLog {
-		log = prettylog.New(pname)
-	}
+	c.refreshFlag = c.Config.RefreshTime
+	c.applyLive()
 
 	fsFactory, ok := c.Drivers[c.Config.Type]
 	if !ok {
@@ -89,10 +107,12 @@ func (c *Core) Init() (err error) {
 	return
 }
 
-//Mount performs the mount
-func (c *Core) Mount() {
+//Mount performs the mount, returns when unmounted with pending changes
+// saved or an error listing what could not be saved
+func (c *Core) Mount() error {
 
 	// Start Selected driveFS
+	coreutil.SdNotify("STATUS=Loading file list")
 	c.CurrentFS.Start() // Should not block
 	//////////////
 	// Server
@@ -106,24 +126,66 @@ func (c *Core) Mount() {
 
 	fsname := c.Config.Source
 
-	var dbgLogger *glog.Logger
-	var errLogger *glog.Logger
-	if c.Config.Verbose2Log { // Extra verbose
-		dbgLogger = prettylog.New("fuse")
-		errLogger = prettylog.New("fuse-err")
-	}
+	// Extra verbose, can be enabled at runtime
+	dbgLogger := coreutil.VerboseLogger("fuse", 2)
+	errLogger := coreutil.VerboseLogger("fuse-err", 2)
 
 	mfs, err = fuse.Mount(mountPath, server, &fuse.MountConfig{
-		VolumeName: "cloudmount",
-		//Options:     coreutil.OptionMap(c.Config.Options),
+		VolumeName:  "cloudmount",
+		Options:     c.Config.FuseOptions,
 		FSName:      fsname,
 		DebugLogger: dbgLogger,
 		ErrorLogger: errLogger,
 		ReadOnly:    c.Config.Options.Readonly,
 	})
 	if err != nil {
+		coreutil.SdNotify("STATUS=Failed mounting: " + err.Error())
+		coreutil.NotifyReady(fmt.Errorf("failed mounting %s: %v", mountPath, err))
 		errlog.Fatal("Failed mounting path ", flag.Arg(0), err)
 	}
+	if c.Config.PidFile != "" {
+		if err := ioutil.WriteFile(c.Config.PidFile, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+			errlog.Println("Pidfile:", err)
+		}
+		defer os.Remove(c.Config.PidFile)
+	}
+	if l, err := c.serveControl(); err != nil {
+		errlog.Println("Control socket:", err)
+	} else {
+		defer l.Close()
+	}
+
+	// systemd and daemon readiness, once mounted and files are listed
+	loadErr := make(chan error, 1)
+	go func() {
+		if err := <-c.CurrentFS.Loaded(); err != nil {
+			err = fmt.Errorf("failed loading files: %v", err)
+			coreutil.SdNotify("STATUS=" + err.Error())
+			coreutil.NotifyReady(err)
+			loadErr <- err
+			if err := fuse.Unmount(mountPath); err != nil { // Join returns once unmounted
+				errlog.Println("Unmount failed:", err)
+			}
+			return
+		}
+		coreutil.SdNotify("READY=1\nSTATUS=Mounted " + c.Config.Source + " on " + mountPath)
+		coreutil.NotifyReady(nil)
+	}()
+	if interval := coreutil.SdWatchdog(); interval > 0 {
+		go func() {
+			for range time.Tick(interval / 2) {
+				if !c.CurrentFS.Alive(interval) { // Let systemd restart us
+					errlog.Println("Checking for changes is stuck, watchdog not pinged")
+					continue
+				}
+				coreutil.SdNotify("WATCHDOG=1")
+			}
+		}()
+	}
+
+	var stopState int32   // stopIdle, stopSaving or stopUnmounted
+	var stopMU sync.Mutex // Held while saving and unmounting
+	var saveErr error
 
 	// Signal handling to refresh Drives
 	sigs := make(chan os.Signal, 2)
@@ -132,27 +194,47 @@ func (c *Core) Mount() {
 		for sig := range sigs {
 			log.Println("Signal:", sig)
 			switch sig {
-			//case syscall.SIGUSR1:
-			//log.Println("Manually Refresh drive")
-			//go c.CurrentFS.Refresh()
+			case syscall.SIGUSR1:
+				ctl, ok := c.CurrentFS.(Controller)
+				if !ok {
+					errlog.Println("Refresh not supported")
+					continue
+				}
+				go func() {
+					if err := ctl.RefreshNow(false); err != nil {
+						errlog.Println("Refresh failed:", err)
+						return
+					}
+					infolog.Println("Refreshed")
+				}()
 			case syscall.SIGHUP:
-				log.Println("GC")
-				mem := runtime.MemStats{}
-				runtime.ReadMemStats(&mem)
-				log.Printf("Mem: %.2fMB", float64(mem.Alloc)/1024/1024)
-				runtime.GC()
-
-				runtime.ReadMemStats(&mem)
-				log.Printf("After gc: Mem: %.2fMB", float64(mem.Alloc)/1024/1024)
-
-			case os.Interrupt:
-				log.Println("Graceful unmount")
-				fuse.Unmount(mountPath)
-				os.Exit(1)
-			case syscall.SIGTERM:
-				log.Println("Graceful unmount")
-				fuse.Unmount(mountPath)
-				os.Exit(1)
+				go func() {
+					if err := c.Reload(); err != nil {
+						errlog.Println("Reload failed:", err)
+						return
+					}
+					infolog.Println("Config reloaded")
+				}()
+
+			case os.Interrupt, syscall.SIGTERM:
+				if !atomic.CompareAndSwapInt32(&stopState, stopIdle, stopSaving) { // Second signal
+					errlog.Println("Forced exit, pending changes might be lost")
+					c.cleanup()
+					os.Exit(1)
+				}
+				go func() {
+					stopMU.Lock()
+					defer stopMU.Unlock()
+					var err error
+					saveErr, err = c.stop(mountPath)
+					if err != nil { // Still mounted (i.e: files open), keep serving
+						errlog.Println("Unmount failed, still mounted:", err)
+						coreutil.SdNotify("STATUS=Unmount failed, still mounted: " + err.Error())
+						atomic.StoreInt32(&stopState, stopIdle)
+						return
+					}
+					atomic.StoreInt32(&stopState, stopUnmounted)
+				}()
 			}
 
 		}
@@ -161,5 +243,46 @@ func (c *Core) Mount() {
 	if err := mfs.Join(ctx); err != nil {
 		errlog.Fatalf("Joining: %v", err)
 	}
+	select {
+	case err := <-loadErr:
+		return err
+	default:
+	}
+	stopMU.Lock() // Wait for a running graceful unmount
+	defer stopMU.Unlock()
+	if atomic.LoadInt32(&stopState) == stopUnmounted {
+		return saveErr
+	}
+	// Unmounted from outside (i.e: fusermount -u)
+	return c.CurrentFS.Stop(c.Config.Options.StopTimeout)
+}
+
+// Graceful unmount states
+const (
+	stopIdle = iota
+	stopSaving
+	stopUnmounted
+)
+
+// stop refuses new changes, saves pending ones and unmounts, err is set if
+// still mounted, changes are then accepted again
+func (c *Core) stop(mountPath string) (saveErr, err error) {
+	infolog.Println("Graceful unmount, saving pending changes")
+	coreutil.SdNotify("STOPPING=1\nSTATUS=Saving pending changes")
+	saveErr = c.CurrentFS.Stop(c.Config.Options.StopTimeout)
+	if saveErr != nil {
+		errlog.Println(saveErr)
+	}
+	if err = fuse.Unmount(mountPath); err != nil {
+		c.CurrentFS.Resume()
+	}
+	return saveErr, err
+}
 
+// cleanup removes mount files on forced exit
+func (c *Core) cleanup() {
+	if c.Config.PidFile != "" {
+		os.Remove(c.Config.PidFile)
+	}
+	os.Remove(c.Config.MountFile(".sock"))
 }
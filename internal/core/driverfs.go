@@ -1,12 +1,20 @@
 package core
 
-import "github.com/jacobsa/fuse/fuseutil"
+import (
+	"time"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
 
 // DriverFS default interface for fs driver
 type DriverFS interface {
 	fuseutil.FileSystem
 	//Init()
 	Start()
+	Loaded() <-chan error             // Initial listing result, sent once loaded
+	Alive(timeout time.Duration) bool // False if checking for changes is stuck
+	Stop(timeout time.Duration) error // Save pending changes, counterpart of Start
+	Resume()                          // Accept changes again if unmount failed after Stop
 	//Refresh()
 }
 
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gohxs/cloudmount/internal/coreutil"
+)
+
+// Reloader implemented by DriverFS able to reload credentials while mounted
+type Reloader interface {
+	Reload() error
+}
+
+// applyLive applies the settings that can change while mounted
+func (c *Core) applyLive() {
+	refresh := c.refreshFlag
+	if c.Config.Options.Refresh > 0 {
+		refresh = c.Config.Options.Refresh
+	}
+	c.Config.SetRefresh(refresh)
+	level := c.Config.Options.Verbose
+	if c.Config.VerboseLog && level < 1 {
+		level = 1
+	}
+	if c.Config.Verbose2Log {
+		level = 2
+	}
+	coreutil.SetVerbose(level)
+	coreutil.SetRateLimit(c.Config.Options.RateLimit)
+}
+
+// Reload reads <source> mount_options and -o again over the defaults,
+// applies refresh, verbose and rate_limit and reloads the service
+// credentials, other changes need a remount
+func (c *Core) Reload() error {
+	source := struct {
+		Root         string `json:"root" yaml:"root"`
+		MountOptions string `json:"mount_options" yaml:"mount_options"`
+	}{}
+	if err := coreutil.ParseConfigKeys(c.Config.Source, &source); err != nil {
+		return err
+	}
+
+	opts := c.defaults // Removed options go back to default
+	opts.Root = source.Root
+	set := coreutil.OptionSet{"": &opts}
+	for driver, dopts := range c.Config.DriverOptions { // Parsed on new ones, only validated
+		set[driver] = reflect.New(reflect.TypeOf(dopts).Elem()).Interface()
+	}
+	for _, o := range []string{source.MountOptions, c.Config.MountOptions} {
+		if err := coreutil.ParseMountOptions(o, set, map[string]string{}); err != nil {
+			return fmt.Errorf("mount options: %v", err)
+		}
+	}
+
+	c.Config.Options.Refresh = opts.Refresh
+	c.Config.Options.Verbose = opts.Verbose
+	c.Config.Options.RateLimit = opts.RateLimit
+	if opts != c.Config.Options {
+		infolog.Println("Mount option changes other than refresh, verbose and rate_limit need a remount")
+	}
+	c.applyLive()
+	log.Printf("Refresh: %v, verbose: %d, rate limit: %v/s", c.Config.Refresh(), coreutil.Verbose(), opts.RateLimit)
+
+	if r, ok := c.CurrentFS.(Reloader); ok {
+		if err := r.Reload(); err != nil {
+			return fmt.Errorf("credentials: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,390 @@
+package coreutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+)
+
+// Validator implemented by configs that check their values after parsing
+type Validator interface {
+	Validate() error
+}
+
+// FieldError invalid value in a config field, Field is the key path
+// (i.e: client_secret.client_id)
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Msg)
+}
+
+// ConfigError error in a config file, Line is 0 if unknown
+type ConfigError struct {
+	File  string
+	Line  int
+	Field string
+	Msg   string
+}
+
+func (e *ConfigError) Error() string {
+	loc := e.File
+	if e.Line > 0 {
+		loc += ":" + strconv.Itoa(e.Line)
+	}
+	if e.Field != "" {
+		return fmt.Sprintf("%s: field '%s': %s", loc, e.Field, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", loc, e.Msg)
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} with environment values, returns the first unset
+// reference if any
+func expandEnv(data []byte) ([]byte, string) {
+	missing := ""
+	ret := envRef.ReplaceAllFunc(data, func(ref []byte) []byte {
+		v, ok := os.LookupEnv(string(ref[2 : len(ref)-1]))
+		if !ok && missing == "" {
+			missing = string(ref)
+		}
+		return []byte(v)
+	})
+	return ret, missing
+}
+
+// expandEnv expands ${VAR} in the decoded string values of data so values
+// can't change the document and references in comments are ignored, unset
+// variables are errors
+func (cs *configSource) expandEnv(data []byte) ([]byte, error) {
+	if !envRef.Match(data) {
+		return data, nil
+	}
+	m, err := unmarshalGeneric(cs.file, data)
+	if err != nil || m == nil { // Let the caller handle it
+		return data, nil
+	}
+	e := &envExpander{}
+	ret := e.expand(m, "").(map[string]interface{})
+	if e.missing != "" {
+		return nil, &ConfigError{
+			File:  cs.file,
+			Line:  keyLine(cs.orig, cs.path(e.field)),
+			Field: e.field,
+			Msg:   fmt.Sprintf("environment variable %s is not set", e.missing[2:len(e.missing)-1]),
+		}
+	}
+	if !e.changed {
+		return data, nil
+	}
+	return marshalGeneric(cs.file, ret)
+}
+
+// envExpander expands references in decoded values, keeps the first unset
+type envExpander struct {
+	changed bool
+	missing string
+	field   string // Key path of missing
+}
+
+func (e *envExpander) expand(v interface{}, path string) interface{} {
+	switch t := v.(type) {
+	case string:
+		if !envRef.MatchString(t) {
+			return t
+		}
+		exp, missing := expandEnv([]byte(t))
+		if missing != "" && e.missing == "" {
+			e.missing, e.field = missing, path
+		}
+		e.changed = true
+		if envRef.FindString(t) == t { // Whole value, might be a number or bool
+			var scalar interface{}
+			if yaml.Unmarshal(exp, &scalar) == nil {
+				switch scalar.(type) {
+				case int, float64, bool:
+					return scalar
+				}
+			}
+		}
+		return string(exp)
+	case map[string]interface{}:
+		for k, v := range t {
+			key := k
+			if path != "" {
+				key = path + "." + k
+			}
+			t[k] = e.expand(v, key)
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = e.expand(t[i], path)
+		}
+	}
+	return v
+}
+
+// keepEnvRefs keeps ${VAR} references from cur (current file) where next
+// holds the same expanded value, so saving does not write them out
+func keepEnvRefs(cur, next interface{}) interface{} {
+	switch c := cur.(type) {
+	case string:
+		if envRef.MatchString(c) {
+			if exp, missing := expandEnv([]byte(c)); missing == "" && string(exp) == fmt.Sprint(next) {
+				return c
+			}
+		}
+	case map[string]interface{}:
+		n, ok := next.(map[string]interface{})
+		if !ok {
+			return next
+		}
+		for k, v := range n {
+			n[k] = keepEnvRefs(c[k], v)
+		}
+	}
+	return next
+}
+
+// restoreEnvRefs puts back ${VAR} references of the current data
+func restoreEnvRefs(cs *configSource, current, data []byte) ([]byte, error) {
+	if !envRef.Match(current) {
+		return data, nil
+	}
+	cm, err := unmarshalGeneric(cs.file, current)
+	if err != nil {
+		return data, nil
+	}
+	m, err := unmarshalGeneric(cs.file, data)
+	if err != nil {
+		return nil, err
+	}
+	return marshalGeneric(cs.file, keepEnvRefs(cm, m).(map[string]interface{}))
+}
+
+var yamlLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+var yamlField = regexp.MustCompile(`field (\S+) not found`)
+
+// exact checks if data lines match the file lines
+func (cs *configSource) exact(data []byte) bool {
+	return bytes.Equal(cs.orig, data)
+}
+
+// decodeError adds file and line to yaml or json errors
+func (cs *configSource) decodeError(data []byte, err error) error {
+	if strings.HasSuffix(cs.file, ".json") {
+		return cs.jsonError(data, nil, err)
+	}
+	return cs.yamlError(data, err)
+}
+
+// yamlError adds file and line to yaml errors, lines are searched in the
+// original file by key path if data was rewritten
+func (cs *configSource) yamlError(data []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	var msgs []string
+	switch e := err.(type) {
+	case *yaml.TypeError:
+		msgs = e.Errors
+	default:
+		msgs = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+	cerr := &ConfigError{File: cs.file, Msg: msgs[0]}
+	path := ""
+	if m := yamlLine.FindStringSubmatch(msgs[0]); m != nil {
+		cerr.Msg = m[2]
+		cerr.Line, _ = strconv.Atoi(m[1])
+		path = keyPath(data, cerr.Line)
+		if !cs.exact(data) {
+			cerr.Line = 0
+			if path != "" {
+				cerr.Line = keyLine(cs.orig, cs.path(path))
+			}
+		}
+	}
+	if m := yamlField.FindStringSubmatch(cerr.Msg); m != nil {
+		cerr.Field, cerr.Msg = m[1], "unknown key"
+		if strings.HasSuffix(path, "."+m[1]) {
+			cerr.Field = path
+		}
+	}
+	return cerr
+}
+
+// jsonError adds file, line and field to json errors, out is the decoded
+// value to find unknown keys, it can be nil
+func (cs *configSource) jsonError(data []byte, out interface{}, err error) error {
+	if err == nil {
+		return nil
+	}
+	cerr := &ConfigError{File: cs.file, Msg: strings.TrimPrefix(err.Error(), "json: ")}
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		cerr.Line = lineOf(data, int(e.Offset))
+	case *json.UnmarshalTypeError:
+		cerr.Field = e.Field
+		cerr.Msg = fmt.Sprintf("cannot use %s as %s", e.Value, e.Type)
+		cerr.Line = lineOf(data, int(e.Offset))
+	default:
+		if strings.HasPrefix(cerr.Msg, "unknown field ") {
+			cerr.Field, _ = strconv.Unquote(strings.TrimPrefix(cerr.Msg, "unknown field "))
+			cerr.Msg = "unknown key"
+			// No path in the error, use the first key with the name not in out
+			for i, line := range strings.Split(string(data), "\n") {
+				if _, k := lineKey(line); k == cerr.Field {
+					if path := keyPath(data, i+1); out == nil || !hasField(reflect.TypeOf(out), path) {
+						cerr.Field = path
+						break
+					}
+				}
+			}
+		}
+	}
+	if !cs.exact(data) {
+		cerr.Line = 0
+	}
+	if cerr.Line == 0 && cerr.Field != "" {
+		cerr.Line = keyLine(cs.orig, cs.path(cerr.Field))
+	}
+	return cerr
+}
+
+// validateError adds file and line to Validate errors
+func (cs *configSource) validateError(err error) error {
+	ferr, ok := err.(*FieldError)
+	if !ok {
+		return &ConfigError{File: cs.file, Msg: err.Error()}
+	}
+	return &ConfigError{File: cs.file, Line: keyLine(cs.orig, cs.path(ferr.Field)), Field: ferr.Field, Msg: ferr.Msg}
+}
+
+var keyRe = regexp.MustCompile(`^(\s*(?:- +)*\{?\s*)(?:"([^"]*)"|([A-Za-z0-9_.-]+))\s*:`)
+
+// lineKey returns the key of a yaml or json line and its column, "" if none
+func lineKey(line string) (int, string) {
+	m := keyRe.FindStringSubmatch(line)
+	if m == nil {
+		return 0, ""
+	}
+	return len(m[1]), m[2] + m[3]
+}
+
+// keyLine finds the line of a key path (a.b.c) in yaml or json data, each
+// key is searched in the block of its parent, keys with a different case
+// only match if there is no exact one (json), returns the line of the
+// closest parent if the key is not found, 0 if none
+func keyLine(data []byte, path string) int {
+	lines := strings.Split(string(data), "\n")
+	start, end, found := 0, len(lines), 0
+	for _, key := range strings.Split(path, ".") {
+		col := -1 // Column of the keys in the block
+		for i := start; i < end; i++ {
+			if c, k := lineKey(lines[i]); k != "" && (col == -1 || c < col) {
+				col = c
+			}
+		}
+		match := -1
+		for i := start; i < end; i++ {
+			c, k := lineKey(lines[i])
+			if c != col {
+				continue
+			}
+			if k == key {
+				match = i
+				break
+			}
+			if match == -1 && strings.EqualFold(k, key) {
+				match = i
+			}
+		}
+		if match == -1 {
+			// Flow style or single line json (i.e: a: {b: 1})
+			inline := regexp.MustCompile(`[{,]\s*"?` + regexp.QuoteMeta(key) + `"?\s*:`)
+			if found > 0 && inline.MatchString(lines[found-1]) {
+				start = end
+				continue
+			}
+			return found
+		}
+		found = match + 1
+		start = match + 1
+		for i := start; i < end; i++ {
+			if c, k := lineKey(lines[i]); k != "" && c <= col {
+				end = i
+				break
+			}
+		}
+	}
+	return found
+}
+
+// keyPath returns the key path (a.b.c) of a line in yaml or json data, ""
+// if the line has no key
+func keyPath(data []byte, line int) string {
+	lines := strings.Split(string(data), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	col, path := lineKey(lines[line-1])
+	if path == "" {
+		return ""
+	}
+	for i := line - 2; i >= 0 && col > 0; i-- {
+		if c, k := lineKey(lines[i]); k != "" && c < col {
+			col, path = c, k+"."+path
+		}
+	}
+	return path
+}
+
+// hasField checks if a key path is decoded into a field of t, json keys
+// match fields case insensitively and maps accept any key
+func hasField(t reflect.Type, path string) bool {
+	for _, key := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return t.Kind() == reflect.Map || t.Kind() == reflect.Interface
+		}
+		var field reflect.Type
+		for i := 0; i < t.NumField() && field == nil; i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = t.Field(i).Name
+			}
+			if strings.EqualFold(name, key) {
+				field = t.Field(i).Type
+			}
+		}
+		if field == nil {
+			return false
+		}
+		t = field
+	}
+	return true
+}
+
+// lineOf returns the line number of a byte offset
+func lineOf(data []byte, offset int) int {
+	if offset < 0 {
+		return 0
+	}
+	if offset > len(data) {
+		offset = len(data)
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,116 @@
+package coreutil
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyLine(t *testing.T) {
+	yamlData := "type: gdrive\nroot: /\nclient:\n  id: x\n  root: /a\n  list:\n    - name: a\n      root: /b\nauth:\n  root: /c\nflow: {root: /d}\n"
+	jsonData := "{\n  \"root\": \"/\",\n  \"client\": {\n    \"Root\": \"/a\",\n    \"id\": \"x\"\n  },\n  \"id\": \"y\"\n}"
+	tests := []struct {
+		name string
+		data string
+		path string
+		want int
+	}{
+		{"top", yamlData, "root", 2},
+		{"nested", yamlData, "client.root", 5},
+		{"list", yamlData, "client.list.root", 8},
+		{"other block", yamlData, "auth.root", 10},
+		{"flow", yamlData, "flow.root", 11},
+		{"missing child", yamlData, "client.secret", 3},
+		{"missing", yamlData, "secret", 0},
+		{"json top", jsonData, "id", 7},
+		{"json nested", jsonData, "client.id", 5},
+		{"json case", jsonData, "client.root", 4},
+		{"json single line", `{"client": {"id": "x"}}`, "client.id", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyLine([]byte(tt.data), tt.path); got != tt.want {
+				t.Errorf("keyLine(%q) = %d, want %d", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyPath(t *testing.T) {
+	data := []byte("type: gdrive\nclient:\n  id: x\n  list:\n    - name: a\n      root: /b\n")
+	for line, want := range map[int]string{1: "type", 3: "client.id", 6: "client.list.root", 7: "", 9: ""} {
+		if got := keyPath(data, line); got != want {
+			t.Errorf("keyPath(%d) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+type errorsConfig struct {
+	Type   string `json:"type" yaml:"type"`
+	Root   string `json:"root" yaml:"root"`
+	Count  int    `json:"count" yaml:"count"`
+	Client struct {
+		ID    string `json:"id" yaml:"id"`
+		Count int    `json:"count" yaml:"count"`
+	} `json:"client" yaml:"client"`
+}
+
+func (c *errorsConfig) Validate() error {
+	if c.Client.ID == "bad" {
+		return &FieldError{Field: "client.id", Msg: "invalid id"}
+	}
+	return nil
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		ext   string
+		data  string
+		line  int
+		field string
+		msg   string
+	}{
+		{"unknown key", ".yaml", "type: gdrive\nroot: /\nclient:\n  id: x\n  root: /\n", 5, "client.root", "unknown key"},
+		{"unknown key", ".json", "{\n  \"type\": \"gdrive\",\n  \"root\": \"/\",\n  \"client\": {\n    \"id\": \"x\",\n    \"root\": \"/\"\n  }\n}", 6, "client.root", "unknown key"},
+		{"type", ".yaml", "count: 1\nclient:\n  count: abc\n", 3, "", "cannot unmarshal"},
+		{"type", ".json", "{\n  \"count\": 1,\n  \"client\": {\n    \"count\": \"abc\"\n  }\n}", 4, "client.count", "cannot use"},
+		{"unset env", ".yaml", "type: gdrive\nclient:\n  id: ${CM_TEST_UNSET}\n", 3, "client.id", "CM_TEST_UNSET is not set"},
+		{"unset env", ".json", "{\n  \"type\": \"gdrive\",\n  \"client\": {\n    \"id\": \"${CM_TEST_UNSET}\"\n  }\n}", 4, "client.id", "CM_TEST_UNSET is not set"},
+		{"validate", ".yaml", "root: /\nclient:\n  id: bad\n", 3, "client.id", "invalid id"},
+		{"validate", ".json", "{\n  \"root\": \"/\",\n  \"client\": {\n    \"id\": \"bad\"\n  }\n}", 4, "client.id", "invalid id"},
+		{"syntax", ".yaml", "type: gdrive\nclient:\n  id: x\n - bad\nroot: /\n", 3, "", "did not find"},
+		{"syntax", ".json", "{\n  \"type\": \"gdrive\",\n}", 3, "", "invalid character"},
+	}
+	for _, tt := range tests {
+		// The remote section is 2 lines down in a unified file
+		remote := "remotes:\n  work:\n    " + strings.Replace(tt.data, "\n", "\n    ", -1) + "\n"
+		if tt.ext == ".json" {
+			remote = "{\n  \"remotes\": {\n    \"work\": " + strings.Replace(tt.data, "\n", "\n    ", -1) + "\n  }\n}"
+		}
+		for _, src := range []struct {
+			name, data, suffix string
+			line               int
+		}{
+			{"exact", tt.data, "", tt.line},
+			{"remote", remote, "#work", tt.line + 2},
+		} {
+			t.Run(tt.name+tt.ext+"/"+src.name, func(t *testing.T) {
+				file := filepath.Join(t.TempDir(), "config"+tt.ext)
+				if err := ioutil.WriteFile(file, []byte(src.data), 0600); err != nil {
+					t.Fatal(err)
+				}
+				var cerr *ConfigError
+				err := ParseConfig(file+src.suffix, &errorsConfig{})
+				if !errors.As(err, &cerr) {
+					t.Fatalf("ParseConfig error = %v", err)
+				}
+				if cerr.File != file || cerr.Line != src.line || cerr.Field != tt.field || !strings.Contains(cerr.Msg, tt.msg) {
+					t.Errorf("ParseConfig error = %v (line %d, field %q)", err, cerr.Line, cerr.Field)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package coreutil
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+// ReadyEnv holds the fd of the pipe the daemon reports the mount result to
+const ReadyEnv = "CLOUDMOUNT_READY_FD"
+
+var readyOnce sync.Once
+
+// NotifyReady reports the mount result to the process that started the
+// daemon, "OK" if err is nil, only the first call is sent
+func NotifyReady(err error) {
+	readyOnce.Do(func() {
+		fd, perr := strconv.Atoi(os.Getenv(ReadyEnv))
+		if perr != nil {
+			return
+		}
+		os.Unsetenv(ReadyEnv)
+		f := os.NewFile(uintptr(fd), "ready")
+		if f == nil {
+			return
+		}
+		defer f.Close()
+		if err != nil {
+			f.WriteString("ERR " + err.Error() + "\n")
+			return
+		}
+		f.WriteString("OK\n")
+	})
+}
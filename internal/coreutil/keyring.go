@@ -0,0 +1,160 @@
+package coreutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Secret Service D-Bus API (gnome-keyring, kwallet, keepassxc)
+const (
+	secretsDest       = "org.freedesktop.secrets"
+	secretsPath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretsService    = "org.freedesktop.Secret.Service"
+	secretsCollection = "org.freedesktop.Secret.Collection"
+	secretsItem       = "org.freedesktop.Secret.Item"
+	secretsPrompt     = "org.freedesktop.Secret.Prompt"
+	noPrompt          = dbus.ObjectPath("/")
+)
+
+// secretValue org.freedesktop.Secret.Secret (oayays)
+type secretValue struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// keyringStore keeps secrets in the Secret Service default collection on
+// the session bus, items are looked up by service and id attributes
+type keyringStore struct{}
+
+func keyringAttrs(id string) map[string]string {
+	return map[string]string{"service": "cloudmount", "id": id}
+}
+
+func (keyringStore) Get(id string) (string, error) {
+	var ret string
+	err := withSecretService(func(k *secretService) error {
+		var unlocked, locked []dbus.ObjectPath
+		err := k.svc.Call(secretsService+".SearchItems", 0, keyringAttrs(id)).Store(&unlocked, &locked)
+		if err != nil {
+			return err
+		}
+		if len(unlocked) == 0 && len(locked) > 0 {
+			if unlocked, err = k.unlock(locked); err != nil {
+				return err
+			}
+		}
+		if len(unlocked) == 0 {
+			return fmt.Errorf("secret '%s' not found", id)
+		}
+		var secret secretValue
+		err = k.conn.Object(secretsDest, unlocked[0]).Call(secretsItem+".GetSecret", 0, k.session).Store(&secret)
+		ret = string(secret.Value)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("keyring lookup failed: %v", err)
+	}
+	return ret, nil
+}
+
+func (keyringStore) Set(id, value string) error {
+	err := withSecretService(func(k *secretService) error {
+		var collection dbus.ObjectPath
+		if err := k.svc.Call(secretsService+".ReadAlias", 0, "default").Store(&collection); err != nil {
+			return err
+		}
+		if collection == noPrompt {
+			return errors.New("no default keyring collection")
+		}
+		if _, err := k.unlock([]dbus.ObjectPath{collection}); err != nil {
+			return err
+		}
+		props := map[string]dbus.Variant{
+			secretsItem + ".Label":      dbus.MakeVariant("cloudmount " + id),
+			secretsItem + ".Attributes": dbus.MakeVariant(keyringAttrs(id)),
+		}
+		secret := secretValue{Session: k.session, Value: []byte(value), ContentType: "text/plain"}
+		var item, prompt dbus.ObjectPath
+		err := k.conn.Object(secretsDest, collection).Call(secretsCollection+".CreateItem", 0, props, secret, true).Store(&item, &prompt)
+		if err != nil {
+			return err
+		}
+		_, err = k.prompt(prompt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("keyring store failed: %v", err)
+	}
+	return nil
+}
+
+// secretService session with the Secret Service
+type secretService struct {
+	conn    *dbus.Conn
+	svc     dbus.BusObject
+	session dbus.ObjectPath
+}
+
+// withSecretService opens a plain session on the session bus for fn
+func withSecretService(fn func(k *secretService) error) error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	k := &secretService{conn: conn, svc: conn.Object(secretsDest, secretsPath)}
+	var output dbus.Variant
+	if err := k.svc.Call(secretsService+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &k.session); err != nil {
+		return err
+	}
+	return fn(k)
+}
+
+// unlock unlocks objects, the keyring might prompt the user
+func (k *secretService) unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := k.svc.Call(secretsService+".Unlock", 0, objects).Store(&unlocked, &prompt); err != nil {
+		return nil, err
+	}
+	result, err := k.prompt(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if paths, ok := result.Value().([]dbus.ObjectPath); ok {
+		unlocked = append(unlocked, paths...)
+	}
+	return unlocked, nil
+}
+
+// prompt shows a keyring prompt and waits for its result
+func (k *secretService) prompt(path dbus.ObjectPath) (dbus.Variant, error) {
+	if path == noPrompt || path == "" {
+		return dbus.Variant{}, nil
+	}
+	err := k.conn.AddMatchSignal(dbus.WithMatchObjectPath(path), dbus.WithMatchInterface(secretsPrompt), dbus.WithMatchMember("Completed"))
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+	signals := make(chan *dbus.Signal, 1)
+	k.conn.Signal(signals)
+	defer k.conn.RemoveSignal(signals)
+	if err := k.conn.Object(secretsDest, path).Call(secretsPrompt+".Prompt", 0, "").Err; err != nil {
+		return dbus.Variant{}, err
+	}
+	for sig := range signals {
+		if sig.Path != path || sig.Name != secretsPrompt+".Completed" || len(sig.Body) < 2 {
+			continue
+		}
+		if dismissed, _ := sig.Body[0].(bool); dismissed {
+			return dbus.Variant{}, errors.New("keyring prompt dismissed")
+		}
+		result, _ := sig.Body[1].(dbus.Variant)
+		return result, nil
+	}
+	return dbus.Variant{}, errors.New("keyring connection closed")
+}
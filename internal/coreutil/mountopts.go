@@ -0,0 +1,23 @@
+package coreutil
+
+import "strings"
+
+// FuseOptions common FUSE and kernel mount options shown in usage, any
+// option unknown to cloudmount is passed as is
+var FuseOptions = []string{
+	"allow_other", "allow_root", "auto_unmount", "default_permissions", "nonempty",
+	"max_read", "blksize", "fsname", "subtype",
+	"suid", "nosuid", "dev", "nodev", "exec", "noexec",
+	"atime", "noatime", "diratime", "nodiratime", "relatime", "norelatime", "strictatime",
+	"sync", "async", "dirsync",
+}
+
+// fstabOptions used by mount(8), fstab and systemd, not by the file system
+var fstabOptions = []string{
+	"defaults", "auto", "noauto", "user", "nouser", "users", "owner", "group",
+	"_netdev", "nofail", "comment",
+}
+
+func isFstabOption(key string) bool {
+	return inList(key, fstabOptions) || strings.HasPrefix(key, "x-")
+}
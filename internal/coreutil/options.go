@@ -0,0 +1,265 @@
+package coreutil
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Option struct tags:
+//   opt:"name"             option key, lower case field name by default
+//   desc:"description"     shown in usage
+//   enum:"a,b"             allowed values
+
+// ListSeparator separates list values in options (i.e: convert=a:b)
+const ListSeparator = ":"
+
+// OptionSet option structs by namespace, namespaced keys are
+// <namespace>.<name> (i.e: gdrive.export_docs), "" holds common options
+type OptionSet map[string]interface{}
+
+type optionField struct {
+	val reflect.Value
+	sf  reflect.StructField
+}
+
+// fields maps full option keys to struct fields
+func (set OptionSet) fields() map[string]optionField {
+	ret := map[string]optionField{}
+	for ns, out := range set {
+		val := reflect.ValueOf(out).Elem() // Should be pointer
+		typ := val.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			name := optionName(typ.Field(i))
+			if ns != "" {
+				name = ns + "." + name
+			}
+			ret[name] = optionField{val.Field(i), typ.Field(i)}
+		}
+	}
+	return ret
+}
+
+func optionName(sf reflect.StructField) string {
+	name := strings.ToLower(sf.Name)
+	if tag, ok := sf.Tag.Lookup("opt"); ok {
+		tagParts := strings.Split(tag, ",")
+		if len(tagParts) > 0 && tagParts[0] != "" {
+			name = tagParts[0]
+		}
+	}
+	return name
+}
+
+// ParseOptionSet parses mount options like -o uid=100,gdrive.links=url into
+// the set, unknown keys and values not in enum are errors
+func ParseOptionSet(opt string, set OptionSet) error {
+	return ParseMountOptions(opt, set, nil)
+}
+
+// ParseMountOptions parses options as ParseOptionSet, also accepting mount(8)
+// conventions: fstab only options (noauto, _netdev, x-systemd.*) are ignored
+// and other unknown options are placed in fuseOpts to be passed to the
+// kernel, unknown keys are only errors in a namespace of set (i.e: gdrive.x)
+func ParseMountOptions(opt string, set OptionSet, fuseOpts map[string]string) error {
+	fields := set.fields()
+	for _, part := range strings.Split(opt, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value := part, "true"
+		rawValue := ""
+		if keyindex := strings.Index(part, "="); keyindex != -1 { // Eq
+			key = strings.TrimSpace(part[:keyindex])
+			value = strings.TrimSpace(part[keyindex+1:])
+			rawValue = value
+		}
+		if _, ok := fields["ro"]; ok && key == "rw" { // mount(8) default, opposite of ro
+			key, value = "ro", "false"
+		}
+		f, ok := fields[key]
+		if !ok && fuseOpts != nil && !set.namespaced(key) {
+			if !isFstabOption(key) {
+				fuseOpts[key] = rawValue
+			}
+			continue
+		}
+		if !ok {
+			return unknownOption(key, fields)
+		}
+		if err := StringAssign(value, f.val.Addr().Interface()); err != nil {
+			return fmt.Errorf("option '%s': invalid value '%s': %v", key, value, err)
+		}
+		if enum := f.sf.Tag.Get("enum"); enum != "" && !inList(value, strings.Split(enum, ",")) {
+			return fmt.Errorf("option '%s': invalid value '%s', must be one of: %s", key, value, strings.Replace(enum, ",", ", ", -1))
+		}
+	}
+	return nil
+}
+
+// namespaced checks if key is in a namespace of the set (i.e: gdrive.links)
+func (set OptionSet) namespaced(key string) bool {
+	i := strings.Index(key, ".")
+	if i <= 0 {
+		return false
+	}
+	_, ok := set[key[:i]]
+	return ok
+}
+
+// Usage lists options with type, current value and description
+func (set OptionSet) Usage() string {
+	fields := set.fields()
+	keys := []string{}
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { // Common options first
+		ni, nj := strings.Contains(keys[i], "."), strings.Contains(keys[j], ".")
+		if ni != nj {
+			return nj
+		}
+		return keys[i] < keys[j]
+	})
+
+	ret := ""
+	for _, k := range keys {
+		f := fields[k]
+		typ := optionType(f)
+		line := fmt.Sprintf("    %s=<%s>", k, typ)
+		if desc := f.sf.Tag.Get("desc"); desc != "" {
+			line = fmt.Sprintf("%-36s %s", line, desc)
+		}
+		if def := optionValue(f.val); def != "" {
+			line += fmt.Sprintf(" (default %s)", def)
+		}
+		ret += line + "\n"
+	}
+	return ret
+}
+
+func optionType(f optionField) string {
+	if enum := f.sf.Tag.Get("enum"); enum != "" {
+		return strings.Replace(enum, ",", "|", -1)
+	}
+	switch f.val.Interface().(type) {
+	case ByteSize:
+		return "size"
+	}
+	if f.val.Kind() == reflect.Slice {
+		return "list"
+	}
+	if f.val.Type().String() == "time.Duration" {
+		return "duration"
+	}
+	return f.val.Kind().String()
+}
+
+func optionValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Slice:
+		items := []string{}
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, fmt.Sprint(v.Index(i).Interface()))
+		}
+		return strings.Join(items, ListSeparator)
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		if !v.Bool() {
+			return ""
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// unknownOption error with the closest known keys
+func unknownOption(key string, fields map[string]optionField) error {
+	suggestions := []string{}
+	for k := range fields {
+		d := levenshtein(key, k)
+		if d <= 2 || d <= len(key)/3 || strings.HasSuffix(k, "."+key) {
+			suggestions = append(suggestions, k)
+		}
+	}
+	if len(suggestions) == 0 {
+		return fmt.Errorf("unknown option '%s'", key)
+	}
+	sort.Strings(suggestions)
+	return fmt.Errorf("unknown option '%s', did you mean: %s", key, strings.Join(suggestions, ", "))
+}
+
+func inList(s string, list []string) bool {
+	for _, v := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// ByteSize size in bytes, parsed from 512, 64K, 1.5M, 2G, 1T (powers of 1024)
+type ByteSize uint64
+
+var byteUnits = []string{"", "K", "M", "G", "T", "P"}
+
+// ParseByteSize parses a size with optional unit (K, KB, KiB...)
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	num := strings.TrimRightFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	unit := strings.ToUpper(strings.TrimSpace(s[len(num):]))
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I")
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	for i, u := range byteUnits {
+		if u == unit {
+			return ByteSize(f * float64(uint64(1)<<(10*uint(i)))), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid size unit in '%s'", s)
+}
+
+func (b ByteSize) String() string {
+	for i := len(byteUnits) - 1; i > 0; i-- {
+		n := uint64(1) << (10 * uint(i))
+		if uint64(b) >= n && uint64(b)%n == 0 {
+			return fmt.Sprintf("%d%s", uint64(b)/n, byteUnits[i])
+		}
+	}
+	return strconv.FormatUint(uint64(b), 10)
+}
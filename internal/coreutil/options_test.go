@@ -0,0 +1,117 @@
+package coreutil
+
+import (
+	"strings"
+	"testing"
+)
+
+type testOptions struct {
+	UID       uint32   `opt:"uid"`
+	CacheSize ByteSize `opt:"cache_size"`
+	Mode      string   `opt:"mode" enum:"fast,safe"`
+}
+
+type testDriverOptions struct {
+	Links  string `opt:"links" enum:"desktop,url"`
+	Export string `opt:"export_docs"`
+}
+
+func TestParseOptionSet(t *testing.T) {
+	tests := []struct {
+		opt string
+		err string
+	}{
+		{"uid=100,cache_size=64M,mode=safe,drive.links=url", ""},
+		{"mode=slow", "option 'mode': invalid value 'slow', must be one of: fast, safe"},
+		{"drive.links=web", "must be one of: desktop, url"},
+		{"uid=abc", "option 'uid': invalid value 'abc'"},
+		{"cache_size=12X", "invalid size unit"},
+		{"udi=100", "unknown option 'udi', did you mean: uid"},
+		{"links=url", "unknown option 'links', did you mean: drive.links"},
+		{"drive.export_doc=pdf", "did you mean: drive.export_docs"},
+		{"cachesize=1K", "did you mean: cache_size"},
+		{"unrelated", "unknown option 'unrelated'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.opt, func(t *testing.T) {
+			opts, drv := testOptions{}, testDriverOptions{}
+			err := ParseOptionSet(tt.opt, OptionSet{"": &opts, "drive": &drv})
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("ParseOptionSet: %v", err)
+				}
+				if opts.UID != 100 || opts.CacheSize != 64<<20 || opts.Mode != "safe" || drv.Links != "url" {
+					t.Errorf("parsed %+v %+v", opts, drv)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseOptionSet error = %v, want %q", err, tt.err)
+			}
+			if strings.HasSuffix(tt.err, "'unrelated'") && strings.Contains(err.Error(), "did you mean") {
+				t.Errorf("ParseOptionSet suggested unrelated options: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseMountOptions(t *testing.T) {
+	opts, drv := testOptions{}, testDriverOptions{}
+	set := OptionSet{"": &opts, "drive": &drv}
+	fuseOpts := map[string]string{}
+	err := ParseMountOptions("uid=100,rw,_netdev,noauto,x-systemd.automount,allow_other,max_read=4096,other.opt=1,fancy", set, fuseOpts)
+	if err != nil {
+		t.Fatalf("ParseMountOptions: %v", err)
+	}
+	want := map[string]string{"rw": "", "allow_other": "", "max_read": "4096", "other.opt": "1", "fancy": ""}
+	if len(fuseOpts) != len(want) {
+		t.Errorf("fuse options = %v, want %v", fuseOpts, want)
+	}
+	for k, v := range want {
+		if got, ok := fuseOpts[k]; !ok || got != v {
+			t.Errorf("fuse option %s = %q, want %q", k, got, v)
+		}
+	}
+	if opts.UID != 100 {
+		t.Errorf("uid = %d", opts.UID)
+	}
+
+	err = ParseMountOptions("allow_other,drive.lnks=url", set, map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "unknown option 'drive.lnks', did you mean: drive.links") {
+		t.Errorf("namespaced unknown option error = %v", err)
+	}
+	if err := ParseOptionSet("allow_other", set); err == nil {
+		t.Error("ParseOptionSet accepted a FUSE option")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ByteSize
+		err  bool
+	}{
+		{"512", 512, false},
+		{"64K", 64 << 10, false},
+		{"64kb", 64 << 10, false},
+		{"64KiB", 64 << 10, false},
+		{"1.5M", 3 << 19, false},
+		{" 2 G ", 2 << 30, false},
+		{"1T", 1 << 40, false},
+		{"", 0, true},
+		{"M", 0, true},
+		{"-1K", 0, true},
+		{"10X", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.in)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("ParseByteSize(%q) = %d, %v want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for size, want := range map[ByteSize]string{0: "0", 512: "512", 64 << 10: "64K", 3 << 19: "1536K", 2 << 30: "2G", 1025: "1025"} {
+		if got := size.String(); got != want {
+			t.Errorf("ByteSize(%d).String() = %q, want %q", size, got, want)
+		}
+	}
+}
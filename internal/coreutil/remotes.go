@@ -0,0 +1,142 @@
+package coreutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// A unified config file can hold several named remotes, selected in source
+// as 'config.yaml#name':
+//   remotes:
+//     work-drive:
+//       type: gdrive
+//       root: Projects
+//       client_secret: ...
+const remotesKey = "remotes"
+
+// SplitRemote splits a source into config file and remote name, the source
+// is a plain file (i.e: a path containing '#') unless the part before the
+// last '#' is an existing config file
+func SplitRemote(source string) (file string, remote string) {
+	i := strings.LastIndex(source, "#")
+	if i == -1 || strings.Contains(source[i+1:], "/") {
+		return source, ""
+	}
+	if _, err := os.Stat(source); err == nil {
+		return source, ""
+	}
+	if st, err := os.Stat(source[:i]); err != nil || st.IsDir() {
+		return source, ""
+	}
+	return source[:i], source[i+1:]
+}
+
+// configSource a config file or a remote in a unified config file
+type configSource struct {
+	name   string // Source as given
+	file   string
+	remote string
+	orig   []byte // Whole file
+}
+
+// openConfig reads the config file of source, returned source is usable
+// even if the file does not exist
+func openConfig(source string) (*configSource, error) {
+	cs := &configSource{name: source}
+	cs.file, cs.remote = SplitRemote(source)
+	var err error
+	cs.orig, err = ioutil.ReadFile(cs.file)
+	return cs, err
+}
+
+// section returns the remote data or the whole file
+func (cs *configSource) section() ([]byte, error) {
+	if cs.remote == "" {
+		return cs.orig, nil
+	}
+	m, err := unmarshalGeneric(cs.file, cs.orig)
+	if err != nil {
+		return nil, cs.decodeError(cs.orig, err)
+	}
+	remotes, _ := m[remotesKey].(map[string]interface{})
+	section, ok := remotes[cs.remote].(map[string]interface{})
+	if !ok {
+		return nil, &ConfigError{File: cs.file, Msg: fmt.Sprintf("remote '%s' not found", cs.remote)}
+	}
+	if _, ok := section[secretsKey]; !ok && m[secretsKey] != nil { // Inherit secrets store
+		section[secretsKey] = m[secretsKey]
+	}
+	return marshalGeneric(cs.file, section)
+}
+
+// merge places data in the file keeping current keys that are not in data
+func (cs *configSource) merge(current, data []byte) ([]byte, error) {
+	m, err := unmarshalGeneric(cs.file, data)
+	if err != nil {
+		return nil, err
+	}
+	if cm, err := unmarshalGeneric(cs.file, current); err == nil {
+		for k, v := range cm {
+			if _, ok := m[k]; !ok {
+				m[k] = v
+			}
+		}
+	}
+	if cs.remote == "" {
+		return marshalGeneric(cs.file, m)
+	}
+	whole, err := unmarshalGeneric(cs.file, cs.orig)
+	if err != nil {
+		return nil, err
+	}
+	remotes, _ := whole[remotesKey].(map[string]interface{})
+	if remotes == nil {
+		remotes = map[string]interface{}{}
+	}
+	if old, _ := remotes[cs.remote].(map[string]interface{}); old[secretsKey] == nil {
+		if kind, ok := m[secretsKey].(string); ok && kind == whole[secretsKey] { // Inherited
+			delete(m, secretsKey)
+		}
+	}
+	remotes[cs.remote] = m
+	whole[remotesKey] = remotes
+	return marshalGeneric(cs.file, whole)
+}
+
+// path returns the key path in the whole file
+func (cs *configSource) path(field string) string {
+	if cs.remote == "" {
+		return field
+	}
+	return remotesKey + "." + cs.remote + "." + field
+}
+
+// secretID identifies a secret of this source in the secrets store
+func (cs *configSource) secretID(key string) string {
+	absName, _ := filepath.Abs(cs.file)
+	if cs.remote != "" {
+		return absName + "#" + cs.remote + "/" + key
+	}
+	return absName + "#" + key
+}
+
+// lockConfig locks file between processes sharing it (i.e: token updates)
+func lockConfig(file string) (unlock func(), err error) {
+	lock := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".lock")
+	f, err := os.OpenFile(lock, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,156 @@
+package coreutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSplitRemote(t *testing.T) {
+	dir := t.TempDir()
+	unified := filepath.Join(dir, "cloudmount.yaml")
+	hashed := filepath.Join(dir, "my#drive.yaml")
+	for _, f := range []string{unified, hashed, filepath.Join(dir, "both.yaml"), filepath.Join(dir, "both.yaml#work")} {
+		if err := ioutil.WriteFile(f, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		source string
+		file   string
+		remote string
+	}{
+		{unified, unified, ""},
+		{unified + "#work", unified, "work"},
+		{unified + "#a#b", unified + "#a#b", ""}, // Missing file before last '#'
+		{hashed, hashed, ""},
+		{filepath.Join(dir, "both.yaml#work"), filepath.Join(dir, "both.yaml#work"), ""}, // Whole source is a file
+		{dir + "#work", dir + "#work", ""},                                               // Directory
+		{unified + "#work/x", unified + "#work/x", ""},
+		{filepath.Join(dir, "missing.yaml#work"), filepath.Join(dir, "missing.yaml#work"), ""},
+	}
+	for _, tt := range tests {
+		file, remote := SplitRemote(tt.source)
+		if file != tt.file || remote != tt.remote {
+			t.Errorf("SplitRemote(%q) = %q, %q want %q, %q", tt.source, file, remote, tt.file, tt.remote)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		remote  string
+		orig    string
+		current string
+		data    string
+		want    string
+	}{
+		{
+			"file", "",
+			"type: gdrive\nroot: /a\n",
+			"type: gdrive\nroot: /a\n",
+			"auth: token\ntype: gdrive\n",
+			"auth: token\nroot: /a\ntype: gdrive\n",
+		},
+		{
+			"remote", "work",
+			"remotes:\n  home:\n    type: mega\n  work:\n    root: /a\n    type: gdrive\ntype: other\n",
+			"root: /a\ntype: gdrive\n",
+			"auth: token\ntype: gdrive\n",
+			"remotes:\n  home:\n    type: mega\n  work:\n    auth: token\n    root: /a\n    type: gdrive\ntype: other\n",
+		},
+		{
+			"new remote", "work",
+			"remotes:\n  home:\n    type: mega\n",
+			"",
+			"type: gdrive\n",
+			"remotes:\n  home:\n    type: mega\n  work:\n    type: gdrive\n",
+		},
+		{
+			"inherited secrets", "work",
+			"remotes:\n  work:\n    type: gdrive\nsecrets: file\n",
+			"secrets: file\ntype: gdrive\n",
+			"auth: file:id\nsecrets: file\ntype: gdrive\n",
+			"remotes:\n  work:\n    auth: file:id\n    type: gdrive\nsecrets: file\n",
+		},
+		{
+			"own secrets", "work",
+			"remotes:\n  work:\n    secrets: keyring\n    type: gdrive\nsecrets: file\n",
+			"secrets: keyring\ntype: gdrive\n",
+			"secrets: keyring\ntype: gdrive\n",
+			"remotes:\n  work:\n    secrets: keyring\n    type: gdrive\nsecrets: file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &configSource{file: "config.yaml", remote: tt.remote, orig: []byte(tt.orig)}
+			got, err := cs.merge([]byte(tt.current), []byte(tt.data))
+			if err != nil || string(got) != tt.want {
+				t.Errorf("merge = %v\n%s\nwant\n%s", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveRemoteSecrets(t *testing.T) {
+	setPassphrase(t, "pass")
+	file := filepath.Join(t.TempDir(), "cloudmount.yaml")
+	orig := "secrets: file\nremotes:\n  work:\n    client_secret:\n      client_id: id\n      client_secret: shh\n    type: gdrive\n"
+	if err := ioutil.WriteFile(file, []byte(orig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		cfg := secretsConfig{}
+		if err := ParseConfig(file+"#work", &cfg); err != nil {
+			t.Fatalf("ParseConfig: %v", err)
+		}
+		if err := SaveConfig(file+"#work", &cfg); err != nil {
+			t.Fatalf("SaveConfig: %v", err)
+		}
+	}
+	data, _ := ioutil.ReadFile(file)
+	if bytes.Count(data, []byte("secrets:")) != 1 || bytes.Contains(data, []byte("shh")) {
+		t.Errorf("saved config:\n%s", data)
+	}
+	cfg := secretsConfig{}
+	if err := ParseConfig(file+"#work", &cfg); err != nil || cfg.ClientSecret.ClientSecret != "shh" {
+		t.Errorf("ParseConfig = %+v, %v", cfg, err)
+	}
+}
+
+func TestLockConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cloudmount.yaml")
+	unlock, err := lockConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(file), ".cloudmount.yaml.lock")); err != nil {
+		t.Errorf("lock file: %v", err)
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := lockConfig(file)
+		if err != nil {
+			t.Error(err)
+		} else {
+			unlock()
+		}
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("second lock taken while locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("second lock not taken after unlock")
+	}
+}
@@ -0,0 +1,352 @@
+package coreutil
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-yaml/yaml"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Credentials and tokens can be kept out of the config file by setting a
+// secrets store in the config:
+//   secrets: keyring # Secret Service keyring, or 'file' for an encrypted file
+// secret values are replaced by references ('keyring:<id>') when the config is
+// saved and resolved when parsed
+
+// Secrets stores
+const (
+	// SecretsKeyring Secret Service keyring over D-Bus (gnome-keyring, kwallet)
+	SecretsKeyring = "keyring"
+	// SecretsFile passphrase encrypted file next to the config
+	SecretsFile = "file"
+
+	secretsKey      = "secrets"
+	secretsFileName = "secrets.enc"
+	// PassphraseEnv environment variable with the secrets file passphrase
+	PassphraseEnv = "CLOUDMOUNT_PASSPHRASE"
+	// PassphraseFDEnv holds the fd of the pipe the daemon reads the passphrase from
+	PassphraseFDEnv = "CLOUDMOUNT_PASSPHRASE_FD"
+)
+
+// Top level config keys holding secrets
+var secretKeys = map[string]bool{
+	"client_secret": true,
+	"auth":          true,
+	"credentials":   true,
+}
+
+// secretStore stores secret values by id
+type secretStore interface {
+	Get(id string) (string, error)
+	Set(id, value string) error
+}
+
+// newSecretStore returns the store kind for configFile
+func newSecretStore(kind, configFile string) (secretStore, error) {
+	switch kind {
+	case SecretsKeyring:
+		return keyringStore{}, nil
+	case SecretsFile:
+		return &fileStore{path: filepath.Join(filepath.Dir(configFile), secretsFileName)}, nil
+	}
+	return nil, fmt.Errorf("unknown secrets store '%s', use %s or %s", kind, SecretsKeyring, SecretsFile)
+}
+
+// resolveSecrets replaces secret references in config data with the values,
+// plain secrets are left as is and moved into the store on SaveConfig
+func resolveSecrets(cs *configSource, data []byte) ([]byte, error) {
+	m, err := unmarshalGeneric(cs.file, data)
+	if err != nil || m == nil { // Let the caller handle it
+		return data, nil
+	}
+	_, hasStore := m[secretsKey]
+	delete(m, secretsKey)
+	changed := false
+	for k, v := range m {
+		ref, _ := v.(string)
+		i := strings.Index(ref, ":")
+		if i == -1 || (ref[:i] != SecretsKeyring && ref[:i] != SecretsFile) {
+			continue
+		}
+		store, err := newSecretStore(ref[:i], cs.file)
+		if err != nil {
+			return nil, err
+		}
+		value, err := store.Get(ref[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to read secret '%s': %v", cs.name, k, err)
+		}
+		var resolved interface{}
+		if err := yaml.Unmarshal([]byte(value), &resolved); err != nil {
+			return nil, fmt.Errorf("%s: invalid secret '%s': %v", cs.name, k, err)
+		}
+		m[k] = jsonable(resolved)
+		changed = true
+	}
+	if !changed && !hasStore {
+		return data, nil
+	}
+	return marshalGeneric(cs.file, m)
+}
+
+// storeSecrets moves secret values into the store set in current config
+// data, data is returned as is if there is no store, values with ${ENV}
+// references stay in the file
+func storeSecrets(cs *configSource, current, data []byte) ([]byte, error) {
+	cm, _ := unmarshalGeneric(cs.file, current)
+	kind, _ := cm[secretsKey].(string)
+	if kind == "" {
+		return data, nil
+	}
+	store, err := newSecretStore(kind, cs.file)
+	if err != nil {
+		return nil, err
+	}
+	m, err := unmarshalGeneric(cs.file, data)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range m {
+		if !secretKeys[strings.ToLower(k)] || v == nil {
+			continue
+		}
+		if ref, ok := v.(string); ok && strings.HasPrefix(ref, kind+":") { // Already stored
+			continue
+		}
+		value, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if envRef.Match(value) { // Expanded when parsed, not a secret to store
+			continue
+		}
+		id := cs.secretID(strings.ToLower(k))
+		if err := store.Set(id, string(value)); err != nil {
+			return nil, err
+		}
+		m[k] = kind + ":" + id
+	}
+	m[secretsKey] = kind
+	return marshalGeneric(cs.file, m)
+}
+
+// unmarshalGeneric decodes data into a json like map
+func unmarshalGeneric(file string, data []byte) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	var err error
+	if strings.HasSuffix(file, ".json") {
+		err = json.Unmarshal(data, &m)
+	} else {
+		var ym map[interface{}]interface{}
+		err = yaml.Unmarshal(data, &ym)
+		if ym != nil {
+			m = jsonable(ym).(map[string]interface{})
+		}
+	}
+	return m, err
+}
+
+func marshalGeneric(file string, m map[string]interface{}) ([]byte, error) {
+	if strings.HasSuffix(file, ".json") {
+		return json.MarshalIndent(m, "  ", "  ")
+	}
+	return yaml.Marshal(m)
+}
+
+// jsonable converts yaml maps into json encodable maps
+func jsonable(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range t {
+			m[fmt.Sprint(k)] = jsonable(v)
+		}
+		return m
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range t {
+			m[k] = jsonable(v)
+		}
+		return m
+	case []interface{}:
+		for i := range t {
+			t[i] = jsonable(t[i])
+		}
+	}
+	return v
+}
+
+//
+// Encrypted file
+//
+
+// fileStore keeps secrets in a json map encrypted with a passphrase
+// file layout: salt(16) nonce(24) secretbox
+type fileStore struct {
+	sync.Mutex
+	path string
+}
+
+func (fs *fileStore) Get(id string) (string, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	secrets, err := fs.load()
+	if err != nil {
+		return "", err
+	}
+	v, ok := secrets[id]
+	if !ok {
+		return "", fmt.Errorf("secret not found in %s", fs.path)
+	}
+	return v, nil
+}
+
+func (fs *fileStore) Set(id, value string) error {
+	fs.Lock()
+	defer fs.Unlock()
+	secrets, err := fs.load()
+	if os.IsNotExist(err) {
+		secrets, err = map[string]string{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	secrets[id] = value
+	return fs.save(secrets)
+}
+
+func (fs *fileStore) load() (map[string]string, error) {
+	data, err := ioutil.ReadFile(fs.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 16+24 {
+		return nil, fmt.Errorf("%s: invalid secrets file", fs.path)
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	key, err := secretsKeyFor(pass, data[:16])
+	if err != nil {
+		return nil, err
+	}
+	var nonce [24]byte
+	copy(nonce[:], data[16:40])
+	plain, ok := secretbox.Open(nil, data[40:], &nonce, key)
+	if !ok {
+		forgetPassphrase()
+		return nil, fmt.Errorf("%s: wrong passphrase", fs.path)
+	}
+	secrets := map[string]string{}
+	err = json.Unmarshal(plain, &secrets)
+	return secrets, err
+}
+
+func (fs *fileStore) save(secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 16+24)
+	if _, err := io.ReadFull(rand.Reader, header); err != nil {
+		return err
+	}
+	key, err := secretsKeyFor(pass, header[:16])
+	if err != nil {
+		return err
+	}
+	var nonce [24]byte
+	copy(nonce[:], header[16:])
+	return writeFileAtomic(fs.path, secretbox.Seal(header, plain, &nonce, key))
+}
+
+func secretsKeyFor(pass string, salt []byte) (*[32]byte, error) {
+	k, err := scrypt.Key([]byte(pass), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	key := &[32]byte{}
+	copy(key[:], k)
+	return key, nil
+}
+
+var (
+	passMU     sync.Mutex
+	passCached string
+)
+
+// Passphrase returns the secrets passphrase if it was already read, to be
+// handed to the daemon
+func Passphrase() (string, bool) {
+	passMU.Lock()
+	defer passMU.Unlock()
+	return passCached, passCached != ""
+}
+
+// passphrase from environment, the daemon pipe or asked once in the terminal
+func passphrase() (string, error) {
+	passMU.Lock()
+	defer passMU.Unlock()
+	if passCached != "" {
+		return passCached, nil
+	}
+	if p := os.Getenv(PassphraseEnv); p != "" {
+		passCached = p
+		return p, nil
+	}
+	if fd, err := strconv.Atoi(os.Getenv(PassphraseFDEnv)); err == nil {
+		os.Unsetenv(PassphraseFDEnv)
+		f := os.NewFile(uintptr(fd), "passphrase")
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err == nil && len(data) > 0 {
+			passCached = string(data)
+			return passCached, nil
+		}
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", errors.New("secrets passphrase required, set " + PassphraseEnv)
+	}
+	defer tty.Close()
+
+	stty := func(arg string) {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = tty
+		cmd.Run()
+	}
+	fmt.Fprint(tty, "cloudmount secrets passphrase: ")
+	stty("-echo")
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	stty("echo")
+	fmt.Fprintln(tty)
+	if err != nil {
+		return "", err
+	}
+	passCached = strings.TrimRight(line, "\r\n")
+	return passCached, nil
+}
+
+func forgetPassphrase() {
+	passMU.Lock()
+	defer passMU.Unlock()
+	passCached = ""
+}
@@ -0,0 +1,340 @@
+package coreutil
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func setPassphrase(t *testing.T, pass string) {
+	t.Setenv(PassphraseEnv, pass)
+	forgetPassphrase()
+	t.Cleanup(forgetPassphrase)
+}
+
+func TestFileStore(t *testing.T) {
+	setPassphrase(t, "correct horse")
+	store := &fileStore{path: filepath.Join(t.TempDir(), secretsFileName)}
+
+	if _, err := store.Get("a"); err == nil {
+		t.Fatal("Get from missing file should fail")
+	}
+	for id, value := range map[string]string{"a": "1", "b": "two: 2\n"} {
+		if err := store.Set(id, value); err != nil {
+			t.Fatalf("Set(%q): %v", id, err)
+		}
+	}
+	for id, want := range map[string]string{"a": "1", "b": "two: 2\n"} {
+		got, err := store.Get(id)
+		if err != nil || got != want {
+			t.Errorf("Get(%q) = %q, %v want %q", id, got, err, want)
+		}
+	}
+	if _, err := store.Get("c"); err == nil {
+		t.Error("Get of unknown id should fail")
+	}
+
+	data, _ := ioutil.ReadFile(store.path)
+	if bytes.Contains(data, []byte("two")) {
+		t.Error("secrets file is not encrypted")
+	}
+
+	setPassphrase(t, "wrong")
+	if _, err := store.Get("a"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("Get with wrong passphrase: %v", err)
+	}
+}
+
+type secretsConfig struct {
+	ClientSecret struct {
+		ClientID     string `json:"client_id" yaml:"client_id"`
+		ClientSecret string `json:"client_secret" yaml:"client_secret"`
+	} `json:"client_secret" yaml:"client_secret"`
+	Type string `json:"type" yaml:"type"`
+	Auth *struct {
+		AccessToken string `json:"access_token" yaml:"access_token"`
+	} `json:"auth" yaml:"auth"`
+}
+
+func TestSecretsRoundTrip(t *testing.T) {
+	setPassphrase(t, "pass")
+	for _, ext := range []string{".yaml", ".json"} {
+		t.Run(ext, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "gdrive"+ext)
+			orig := "secrets: file\nclient_secret:\n  client_id: id\n  client_secret: shh\ntype: gdrive\n"
+			if ext == ".json" {
+				orig = `{"secrets": "file", "client_secret": {"client_id": "id", "client_secret": "shh"}, "type": "gdrive"}`
+			}
+			if err := ioutil.WriteFile(source, []byte(orig), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := secretsConfig{}
+			if err := ParseConfig(source, &cfg); err != nil {
+				t.Fatalf("ParseConfig: %v", err)
+			}
+			if cfg.ClientSecret.ClientSecret != "shh" {
+				t.Fatalf("plain secret not read: %+v", cfg)
+			}
+			if data, _ := ioutil.ReadFile(source); string(data) != orig {
+				t.Fatalf("ParseConfig changed the config:\n%s", data)
+			}
+
+			cfg.Auth = &struct {
+				AccessToken string `json:"access_token" yaml:"access_token"`
+			}{AccessToken: "token"}
+			if err := SaveConfig(source, &cfg); err != nil {
+				t.Fatalf("SaveConfig: %v", err)
+			}
+			data, _ := ioutil.ReadFile(source)
+			for _, plain := range []string{"shh", "token"} {
+				if bytes.Contains(data, []byte(plain)) {
+					t.Errorf("%q saved in config:\n%s", plain, data)
+				}
+			}
+			if !bytes.Contains(data, []byte(SecretsFile+":")) {
+				t.Errorf("no secret references in config:\n%s", data)
+			}
+			if _, err := os.Stat(filepath.Join(dir, secretsFileName)); err != nil {
+				t.Errorf("secrets file: %v", err)
+			}
+
+			got := secretsConfig{}
+			if err := ParseConfig(source, &got); err != nil {
+				t.Fatalf("ParseConfig saved: %v", err)
+			}
+			if got.ClientSecret != cfg.ClientSecret || got.Type != "gdrive" || got.Auth == nil || got.Auth.AccessToken != "token" {
+				t.Errorf("resolved config = %+v, want %+v", got, cfg)
+			}
+		})
+	}
+}
+
+func TestSecretsEnvRefs(t *testing.T) {
+	setPassphrase(t, "pass")
+	t.Setenv("TEST_GSECRET", "from-env")
+	dir := t.TempDir()
+	source := filepath.Join(dir, "gdrive.yaml")
+	orig := "secrets: file\nclient_secret:\n  client_id: id\n  client_secret: ${TEST_GSECRET}\ntype: gdrive\n"
+	if err := ioutil.WriteFile(source, []byte(orig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := secretsConfig{}
+	if err := ParseConfig(source, &cfg); err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	cfg.Auth = &struct {
+		AccessToken string `json:"access_token" yaml:"access_token"`
+	}{AccessToken: "token"}
+	if err := SaveConfig(source, &cfg); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+	data, _ := ioutil.ReadFile(source)
+	if !bytes.Contains(data, []byte("${TEST_GSECRET}")) || bytes.Contains(data, []byte("from-env")) {
+		t.Errorf("env reference not kept in config:\n%s", data)
+	}
+	if bytes.Contains(data, []byte("token")) {
+		t.Errorf("plain token saved in config:\n%s", data)
+	}
+
+	got := secretsConfig{}
+	if err := ParseConfig(source, &got); err != nil {
+		t.Fatalf("ParseConfig saved: %v", err)
+	}
+	if got.ClientSecret.ClientSecret != "from-env" || got.Auth == nil || got.Auth.AccessToken != "token" {
+		t.Errorf("resolved config = %+v", got)
+	}
+}
+
+//
+// Secret Service stub
+//
+
+const stubCollection = dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+
+type stubKeyring struct {
+	mu     sync.Mutex // Calls are handled in bus goroutines
+	conn   *dbus.Conn
+	items  map[dbus.ObjectPath]*stubItem
+	locked bool // Items are reported locked and unlocked through a prompt
+}
+
+type stubItem struct {
+	attrs map[string]string
+	value []byte
+}
+
+func (s *stubKeyring) OpenSession(alg string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if alg != "plain" {
+		return dbus.Variant{}, "", dbus.MakeFailedError(fmt.Errorf("unsupported algorithm %s", alg))
+	}
+	return dbus.MakeVariant(""), "/org/freedesktop/secrets/session/1", nil
+}
+
+func (s *stubKeyring) SearchItems(attrs map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := []dbus.ObjectPath{}
+	for path, item := range s.items {
+		match := true
+		for k, v := range attrs {
+			match = match && item.attrs[k] == v
+		}
+		if match {
+			found = append(found, path)
+		}
+	}
+	if s.locked {
+		return []dbus.ObjectPath{}, found, nil
+	}
+	return found, []dbus.ObjectPath{}, nil
+}
+
+func (s *stubKeyring) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.locked {
+		return objects, noPrompt, nil
+	}
+	prompt := dbus.ObjectPath("/org/freedesktop/secrets/prompt/1")
+	s.conn.Export(stubPrompt{s, prompt, objects}, prompt, secretsPrompt)
+	return []dbus.ObjectPath{}, prompt, nil
+}
+
+func (s *stubKeyring) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	return stubCollection, nil
+}
+
+type stubPrompt struct {
+	s       *stubKeyring
+	path    dbus.ObjectPath
+	objects []dbus.ObjectPath
+}
+
+func (p stubPrompt) Prompt(windowID string) *dbus.Error {
+	p.s.mu.Lock()
+	p.s.locked = false
+	p.s.mu.Unlock()
+	p.s.conn.Emit(p.path, secretsPrompt+".Completed", false, dbus.MakeVariant(p.objects))
+	return nil
+}
+
+type stubCollectionObj struct{ s *stubKeyring }
+
+func (c stubCollectionObj) CreateItem(props map[string]dbus.Variant, secret secretValue, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	attrs, ok := props[secretsItem+".Attributes"].Value().(map[string]string)
+	if !ok {
+		return "", "", dbus.MakeFailedError(fmt.Errorf("no attributes"))
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	for path, item := range c.s.items {
+		if replace && item.attrs["id"] == attrs["id"] {
+			item.value = secret.Value
+			return path, noPrompt, nil
+		}
+	}
+	path := dbus.ObjectPath(fmt.Sprintf("%s/%d", stubCollection, len(c.s.items)+1))
+	item := &stubItem{attrs: attrs, value: secret.Value}
+	c.s.items[path] = item
+	c.s.conn.Export(stubItemObj{c.s, item}, path, secretsItem)
+	return path, noPrompt, nil
+}
+
+type stubItemObj struct {
+	s    *stubKeyring
+	item *stubItem
+}
+
+func (i stubItemObj) GetSecret(session dbus.ObjectPath) (secretValue, *dbus.Error) {
+	i.s.mu.Lock()
+	defer i.s.mu.Unlock()
+	return secretValue{Session: session, Value: i.item.value, ContentType: "text/plain"}, nil
+}
+
+// startStubKeyring runs a private bus with a stub Secret Service as the
+// session bus
+func startStubKeyring(t *testing.T) *stubKeyring {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	dir := t.TempDir()
+	addr := "unix:path=" + filepath.Join(dir, "bus")
+	conf := filepath.Join(dir, "bus.conf")
+	ioutil.WriteFile(conf, []byte(`<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>`+addr+`</listen>
+  <policy context="default">
+    <allow send_destination="*"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>`), 0600)
+	cmd := exec.Command(daemon, "--nofork", "--config-file="+conf)
+	if err := cmd.Start(); err != nil {
+		t.Skip("dbus-daemon:", err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill(); cmd.Wait() })
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", addr)
+
+	var conn *dbus.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = dbus.ConnectSessionBus(); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("connecting to private bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &stubKeyring{conn: conn, items: map[dbus.ObjectPath]*stubItem{}}
+	conn.Export(s, secretsPath, secretsService)
+	conn.Export(stubCollectionObj{s}, stubCollection, secretsCollection)
+	if reply, err := conn.RequestName(secretsDest, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("owning %s: %v", secretsDest, err)
+	}
+	return s
+}
+
+func TestKeyringStore(t *testing.T) {
+	s := startStubKeyring(t)
+	store := keyringStore{}
+
+	if _, err := store.Get("a"); err == nil {
+		t.Fatal("Get of missing secret should fail")
+	}
+	if err := store.Set("a", "1"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := store.Set("a", "2"); err != nil {
+		t.Fatalf("Set replace: %v", err)
+	}
+	if v, err := store.Get("a"); err != nil || v != "2" {
+		t.Fatalf("Get = %q, %v want 2", v, err)
+	}
+	s.mu.Lock()
+	if len(s.items) != 1 {
+		t.Errorf("items = %d, want 1 replaced", len(s.items))
+	}
+	s.locked = true // Unlocked through the prompt
+	s.mu.Unlock()
+	if v, err := store.Get("a"); err != nil || v != "2" {
+		t.Fatalf("Get locked = %q, %v want 2", v, err)
+	}
+}
@@ -0,0 +1,80 @@
+package coreutil
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SwitchTransport round tripper that can be replaced while in use (i.e:
+// credentials reloaded)
+type SwitchTransport struct {
+	mu sync.RWMutex
+	rt http.RoundTripper
+}
+
+// Set replaces the underlying round tripper
+func (t *SwitchTransport) Set(rt http.RoundTripper) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rt = rt
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *SwitchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	rt := t.rt
+	t.mu.RUnlock()
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return rt.RoundTrip(req)
+}
+
+var rateLimit struct {
+	sync.Mutex
+	interval time.Duration // Between requests, 0 unlimited
+	next     time.Time
+}
+
+// SetRateLimit limits requests per second done through LimitTransport, 0
+// removes the limit
+func SetRateLimit(perSecond float64) {
+	rateLimit.Lock()
+	defer rateLimit.Unlock()
+	rateLimit.interval = 0
+	if perSecond > 0 {
+		rateLimit.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+}
+
+// LimitTransport wraps rt waiting for the rate limit before each request
+func LimitTransport(rt http.RoundTripper) http.RoundTripper {
+	return limitTransport{rt}
+}
+
+type limitTransport struct {
+	rt http.RoundTripper
+}
+
+func (t limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rateLimit.Lock()
+	wait := time.Duration(0)
+	if rateLimit.interval > 0 {
+		now := time.Now()
+		if rateLimit.next.Before(now) {
+			rateLimit.next = now
+		}
+		wait = rateLimit.next.Sub(now)
+		rateLimit.next = rateLimit.next.Add(rateLimit.interval)
+	}
+	rateLimit.Unlock()
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return t.rt.RoundTrip(req)
+}
@@ -1,115 +1,191 @@
 package coreutil
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-yaml/yaml"
 )
 
-// ParseConfig reads yaml or json file into a struct
+// ParseConfig reads yaml or json file into a struct, unknown keys are
+// rejected, ${ENV} references expanded, secret references resolved from the
+// secrets store and the result validated if out is a Validator
 func ParseConfig(srcfile string, out interface{}) (err error) {
+	return parseConfig(srcfile, out, true)
+}
+
+// ParseConfigKeys reads only the keys known by out ignoring the others and
+// skipping validation (i.e: common settings from a driver config)
+func ParseConfigKeys(srcfile string, out interface{}) (err error) {
+	return parseConfig(srcfile, out, false)
+}
+
+func parseConfig(srcfile string, out interface{}, strict bool) (err error) {
 	if srcfile == "" {
 		return
 	}
-	f, err := os.Open(srcfile)
+	cs, err := openConfig(srcfile)
+	if err != nil {
+		return err
+	}
+	data, err := cs.section()
+	if err != nil {
+		return err
+	}
+	data, err = cs.expandEnv(data)
+	if err != nil {
+		return err
+	}
+	data, err = resolveSecrets(cs, data)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	if strings.HasSuffix(srcfile, ".json") {
+	switch {
+	case strings.HasSuffix(cs.file, ".json"):
 		// Read as JSON
-		json.NewDecoder(f).Decode(out)
-		return
-	}
-	if strings.HasSuffix(srcfile, ".yaml") {
-		data, err := ioutil.ReadAll(f)
-		if err != nil {
-			return err
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if strict {
+			dec.DisallowUnknownFields()
 		}
+		err = cs.jsonError(data, out, dec.Decode(out))
+	case isYAML(cs.file):
 		// Read as yaml
-		yaml.Unmarshal(data, out)
+		if strict {
+			err = yaml.UnmarshalStrict(data, out)
+		} else {
+			err = yaml.Unmarshal(data, out)
+		}
+		err = cs.yamlError(data, err)
+	default:
+		return fmt.Errorf("%s: unknown config format, use .yaml, .yml or .json", cs.file)
+	}
+	if err != nil || !strict {
+		return err
+	}
+
+	if v, ok := out.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return cs.validateError(err)
+		}
 	}
-	return err
+	return nil
+}
+
+// isYAML checks the config file extension, .yaml or .yml
+func isYAML(file string) bool {
+	return strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yml")
 }
 
-// SaveConfig saves configuration file in specified 'json or yaml' extension
+// SaveConfig saves configuration file in specified 'json or yaml' extension,
+// the file is locked and replaced atomically, keys not in obj, ${ENV}
+// references and other remotes are kept and secrets are kept in the secrets
+// store if the config sets one
 func SaveConfig(name string, obj interface{}) (err error) {
+	file, _ := SplitRemote(name)
+	unlock, err := lockConfig(file)
+	if err != nil {
+		return fmt.Errorf("unable to lock config: %v", err)
+	}
+	defer unlock()
+
+	cs, err := openConfig(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
 	var data []byte
-	if strings.HasSuffix(name, ".json") {
+	if strings.HasSuffix(file, ".json") {
 		data, err = json.MarshalIndent(obj, "  ", "  ")
 		if err != nil {
 			return err
 		}
 	}
-	if strings.HasSuffix(name, ".yaml") {
+	if isYAML(file) {
 		data, err = yaml.Marshal(obj)
 		if err != nil {
 			return err
 		}
 	}
-
-	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	current, _ := cs.section() // nil if new
+	data, err = restoreEnvRefs(cs, current, data)
 	if err != nil {
-		log.Fatalf("Unable to save config: %v\n", err)
+		return err
+	}
+	data, err = storeSecrets(cs, current, data)
+	if err != nil {
+		return fmt.Errorf("unable to save config secrets: %v", err)
+	}
+	data, err = cs.merge(current, data)
+	if err != nil {
+		return err
 	}
-	defer f.Close()
-
-	f.Write(data)
-	f.Sync()
 
-	return err
+	if err := writeFileAtomic(file, data); err != nil {
+		return fmt.Errorf("unable to save config: %v", err)
+	}
+	return nil
 }
 
-// ParseOptions parses mount options like -o uid=100,gid=100 to struct
-func ParseOptions(opt string, out interface{}) (err error) {
-	mountopts := map[string]string{}
-	parts := strings.Split(opt, ",")
-	// First Map to keyvalue
-	for _, v := range parts {
-		if keyindex := strings.Index(v, "="); keyindex != -1 { // Eq
-			key := strings.TrimSpace(v[:keyindex])
-			value := strings.TrimSpace(v[keyindex+1:])
-			mountopts[key] = value
-		} else {
-			mountopts[v] = "true"
-		}
+// writeFileAtomic writes to a temporary file and renames it so the file is
+// never left half written
+func writeFileAtomic(name string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
 	}
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // Fails after rename
 
-	// Assign map to object by Tag by iterating fields
-	typ := reflect.TypeOf(out).Elem() // Should be pointer
-	val := reflect.ValueOf(out).Elem()
-	for i := 0; i < typ.NumField(); i++ {
-		fieldTyp := typ.Field(i)
-		fieldVal := val.Field(i)
-		name := strings.ToLower(fieldTyp.Name)
-		if tag, ok := fieldTyp.Tag.Lookup("opt"); ok {
-			tagParts := strings.Split(tag, ",")
-			if len(tagParts) > 0 && tagParts[0] != "" {
-				name = tagParts[0]
-			}
-		}
-
-		if v, ok := mountopts[name]; ok {
-			err = StringAssign(v, fieldVal.Addr().Interface())
-			if err != nil {
-				return err
-			}
-		}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
 	}
-	return
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// ParseOptions parses mount options like -o uid=100,gid=100 to struct,
+// unknown keys are errors
+func ParseOptions(opt string, out interface{}) (err error) {
+	return ParseOptionSet(opt, OptionSet{"": out})
 }
 
 // StringAssign parseString and place value in
 func StringAssign(s string, v interface{}) (err error) {
 	val := reflect.ValueOf(v).Elem()
+	switch val.Type() { // Special types first
+	case reflect.TypeOf(time.Duration(0)):
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		val.SetInt(int64(parsed))
+		return nil
+	case reflect.TypeOf(ByteSize(0)):
+		parsed, err := ParseByteSize(s)
+		if err != nil {
+			return err
+		}
+		val.SetUint(uint64(parsed))
+		return nil
+	}
+
 	switch val.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64: // More values
 		parsed, err := strconv.ParseInt(s, 10, 64)
@@ -125,6 +201,12 @@ func StringAssign(s string, v interface{}) (err error) {
 		}
 		sval := reflect.ValueOf(parsed)
 		val.Set(sval.Convert(val.Type()))
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		val.SetFloat(parsed)
 	case reflect.Bool:
 		parsed, err := strconv.ParseBool(s)
 		if err != nil {
@@ -132,6 +214,23 @@ func StringAssign(s string, v interface{}) (err error) {
 		}
 		sval := reflect.ValueOf(parsed)
 		val.Set(sval)
+	case reflect.String:
+		val.SetString(s)
+	case reflect.Slice: // Lists are separated by ':'
+		list := reflect.MakeSlice(val.Type(), 0, 0)
+		for _, item := range strings.Split(s, ListSeparator) {
+			if item == "" {
+				continue
+			}
+			itemVal := reflect.New(val.Type().Elem())
+			if err := StringAssign(item, itemVal.Interface()); err != nil {
+				return err
+			}
+			list = reflect.Append(list, itemVal.Elem())
+		}
+		val.Set(list)
+	default:
+		return fmt.Errorf("unsupported option type %s", val.Type())
 	}
 
 	return
@@ -188,3 +287,25 @@ func OptionMap(o interface{}) map[string]string {
 	}
 	return ret
 }
+
+// EscapePath escapes a path as systemd-escape --path, different paths never
+// escape to the same name
+func EscapePath(path string) string {
+	path = strings.Trim(filepath.Clean(path), "/")
+	if path == "" {
+		return "-"
+	}
+	ret := ""
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '/':
+			ret += "-"
+		case c == '.' && i == 0, !(c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'):
+			ret += fmt.Sprintf(`\x%02x`, c)
+		default:
+			ret += string(c)
+		}
+	}
+	return ret
+}
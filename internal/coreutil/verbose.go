@@ -0,0 +1,42 @@
+package coreutil
+
+import (
+	"io"
+	"log"
+	"sync/atomic"
+
+	"github.com/gohxs/prettylog"
+)
+
+var verboseLevel int32
+
+// SetVerbose sets log verbosity, 0 errors only, 1 verbose (-v), 2 extra
+// verbose (-vv)
+func SetVerbose(level int) {
+	atomic.StoreInt32(&verboseLevel, int32(level))
+}
+
+// Verbose current log verbosity
+func Verbose() int {
+	return int(atomic.LoadInt32(&verboseLevel))
+}
+
+// VerboseLogger logger that only writes while verbosity is at least level,
+// so it can be changed at runtime
+func VerboseLogger(pname string, level int) *log.Logger {
+	l := prettylog.New(pname)
+	l.SetOutput(verboseWriter{l.Writer(), int32(level)})
+	return l
+}
+
+type verboseWriter struct {
+	w     io.Writer
+	level int32
+}
+
+func (v verboseWriter) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&verboseLevel) < v.level {
+		return len(p), nil
+	}
+	return v.w.Write(p)
+}
@@ -3,10 +3,12 @@ package basefs
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"os"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -15,6 +17,8 @@ import (
 	"google.golang.org/api/googleapi"
 
 	"github.com/gohxs/cloudmount/internal/core"
+	"github.com/gohxs/cloudmount/internal/coreutil"
+	"github.com/gohxs/cloudmount/internal/oauth2util"
 	"github.com/gohxs/prettylog"
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
@@ -25,22 +29,52 @@ const maxInodes = math.MaxUint64
 
 var (
 	pname  = "basefs"
-	log    = prettylog.Dummy()
+	log    = coreutil.VerboseLogger(pname, 1)
 	errlog = prettylog.New(pname + "-err")
 	// ErrNotImplemented basic Not implemented error
 	ErrNotImplemented = errors.New("Not implemented")
 	// ErrPermission permission denied error
 	ErrPermission = errors.New("Permission denied")
+	// ErrStopping file system is being unmounted, no more changes accepted
+	ErrStopping = errors.New("Stopping")
 )
 
 type handle struct {
 	ID           fuseops.HandleID
 	entry        *FileEntry
-	uploadOnDone bool
+	mu           sync.Mutex // Serializes reads, writes and uploads
+	uploadOnDone int32      // Changed locally, atomic
 	// Handling for dir
 	entries []fuseutil.Dirent
 }
 
+// dirty reports if handle has changes not uploaded
+func (fh *handle) dirty() bool {
+	return atomic.LoadInt32(&fh.uploadOnDone) != 0
+}
+
+func (fh *handle) setDirty(dirty bool) {
+	var v int32
+	if dirty {
+		v = 1
+	}
+	atomic.StoreInt32(&fh.uploadOnDone, v)
+}
+
+// sync uploads the handle changes if any
+func (fh *handle) sync(fc *FileContainer) error {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if fh.entry.tempFile == nil || !fh.dirty() {
+		return nil
+	}
+	if err := fh.entry.Sync(fc); err != nil {
+		return err
+	}
+	fh.setDirty(false)
+	return nil
+}
+
 // BaseFS data
 type BaseFS struct {
 	fuseutil.NotImplementedFileSystem // Defaults
@@ -50,18 +84,31 @@ type BaseFS struct {
 	fileHandles sync.Map
 	handleMU    *sync.Mutex
 	Service     Service
+	NameEncoder NameEncoder
+	// CaseInsensitive set by drivers whose service compare names ignoring case
+	CaseInsensitive bool
+
+	loaded    chan error
+	refresh   chan refreshRequest // Check for changes now
+	transfers sync.Map            // *core.Transfer running
+	revisions sync.Map            // Revisions load time by versions file dir ID
+	stats     fsStats
+	stopped   int32 // Changes refused, set on Stop
+	busySince int64 // Refresh loop waiting on the service since, unix nano
 }
 
 // New Creates a new BaseFS with config based on core
 func New(core *core.Core) *BaseFS {
-	if core.Config.VerboseLog {
-		log = prettylog.New(pname)
-	}
-
 	fs := &BaseFS{
 		Config:      &core.Config,
 		fileHandles: sync.Map{},
 		handleMU:    &sync.Mutex{},
+		loaded:      make(chan error, 1),
+		refresh:     make(chan refreshRequest),
+		NameEncoder: NameEncoder{
+			Encoding:  core.Config.Options.NameEncoding,
+			LongNames: core.Config.Options.LongNames,
+		},
 	}
 
 	fs.Root = NewFileContainer(fs)
@@ -79,20 +126,70 @@ func New(core *core.Core) *BaseFS {
 func (fs *BaseFS) Start() {
 	// Fill root container and do changes
 	go func() {
-		fs.Refresh()
-		log.Println("Files loaded:", len(fs.Root.fileEntries))
+		err := fs.Refresh()
+		if err != nil {
+			errlog.Println("Error loading files:", err)
+		}
+		log.Println("Files loaded:", fs.Root.Count())
+		fs.loaded <- err
 		for {
-			fs.CheckForChanges()
-			time.Sleep(fs.Config.RefreshTime)
+			if !fs.stopping() { // Entries kept while saving on stop
+				fs.setBusy(true)
+				fs.CheckForChanges()
+				fs.setBusy(false)
+			}
+			select {
+			case req := <-fs.refresh:
+				var err error
+				fs.setBusy(true)
+				if req.full {
+					err = fs.Refresh()
+				}
+				if err == nil {
+					err = fs.CheckForChanges()
+				}
+				fs.setBusy(false)
+				req.done <- err
+			case <-time.After(fs.Config.Refresh()):
+			}
 		}
 	}()
 }
 
+// Loaded receives the initial file listing result once loaded
+func (fs *BaseFS) Loaded() <-chan error {
+	return fs.loaded
+}
+
+// Alive reports false if the refresh loop is waiting on the service for
+// longer than timeout
+func (fs *BaseFS) Alive(timeout time.Duration) bool {
+	since := atomic.LoadInt64(&fs.busySince)
+	return since == 0 || time.Since(time.Unix(0, since)) < timeout
+}
+
+func (fs *BaseFS) setBusy(busy bool) {
+	var since int64
+	if busy {
+		since = time.Now().UnixNano()
+	}
+	atomic.StoreInt64(&fs.busySince, since)
+}
+
 // Refresh should be renamed to Load or something
-func (fs *BaseFS) Refresh() {
+func (fs *BaseFS) Refresh() error {
 	// Try
 	files, err := fs.Service.ListAll()
-	if err != nil { // Repeat refresh maybe?
+	if err != nil { // Keep current entries
+		return err
+	}
+	if ts, ok := fs.trashService(); ok {
+		trashed, err := ts.ListTrash()
+		if err != nil {
+			errlog.Println("Error listing trash:", err)
+		}
+		files = append(files, trashDir())
+		files = append(files, trashed...)
 	}
 	root := NewFileContainer(fs)
 	// Two passes first the ones with existing entries next the non existent
@@ -112,14 +209,17 @@ func (fs *BaseFS) Refresh() {
 		root.FileEntry(file) // Try to find in previous root
 	}
 	fs.Root = root // Swap root
+	// Revisions of the virtual entries are gone
+	fs.revisions.Range(func(id, _ interface{}) bool {
+		fs.revisions.Delete(id)
+		return true
+	})
+	return nil
 }
 
 // CheckForChanges polling
-func (fs *BaseFS) CheckForChanges() {
-	changes, err := fs.Service.Changes()
-	if err != nil {
-		return
-	}
+func (fs *BaseFS) CheckForChanges() error {
+	changes, err := fs.Service.Changes() // Might fail after some pages
 	for _, c := range changes {
 		entry := fs.Root.FindByID(c.ID)
 		if c.Remove {
@@ -139,6 +239,7 @@ func (fs *BaseFS) CheckForChanges() {
 			fs.Root.FileEntry(c.File) // Creating new one
 		}
 	}
+	return err
 }
 
 ////////////////////////////////////////////////////////
@@ -222,17 +323,23 @@ func (fs *BaseFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) (err error
 	if op.Offset == 0 { // Rebuild/rewind dir list
 
 		fh.entries = []fuseutil.Dirent{}
+		fs.versionsList(fh.entry)
 		children := fs.Root.ListByParent(fh.entry)
-		for i, v := range children {
+		for _, v := range children {
+			if hiddenEntry(v) {
+				continue
+			}
 			fusetype := fuseutil.DT_File
 			if v.IsDir() {
 				fusetype = fuseutil.DT_Directory
+			} else if v.IsSymlink() {
+				fusetype = fuseutil.DT_Link
 			}
 			dirEnt := fuseutil.Dirent{
 				Inode:  v.Inode,
 				Name:   v.Name,
 				Type:   fusetype,
-				Offset: fuseops.DirOffset(i) + 1,
+				Offset: fuseops.DirOffset(len(fh.entries)) + 1,
 			}
 			//	written += fuseutil.WriteDirent(fh.buf[written:], dirEnt)
 			fh.entries = append(fh.entries, dirEnt)
@@ -264,7 +371,16 @@ func (fs *BaseFS) SetInodeAttributes(ctx context.Context, op *fuseops.SetInodeAt
 	// Hack to truncate file?
 
 	if op.Size != nil {
+		if fs.stopping() {
+			return fuseErr(ErrStopping)
+		}
 		entry := fs.Root.FindByInode(op.Inode)
+		if entry == nil {
+			return fuse.ENOENT
+		}
+		if IsVirtual(entry.File) {
+			return fuseErr(ErrPermission)
+		}
 
 		if *op.Size != 0 { // We only allow truncate to 0
 			return fuse.ENOSYS
@@ -283,7 +399,7 @@ func (fs *BaseFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAt
 	if f == nil {
 		return fuse.ENOENT
 	}
-	op.Attributes = f.Attr
+	op.Attributes = fs.attr(f)
 	op.AttributesExpiration = time.Now().Add(time.Minute)
 
 	return
@@ -306,6 +422,9 @@ func (fs *BaseFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) (e
 	}
 
 	entry := fs.Root.Lookup(parentFile, op.Name)
+	if entry == nil {
+		entry = fs.versionsLookup(parentFile, op.Name)
+	}
 
 	if entry == nil {
 		return fuse.ENOENT
@@ -315,7 +434,7 @@ func (fs *BaseFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) (e
 
 	now := time.Now()
 	op.Entry = fuseops.ChildInodeEntry{
-		Attributes:           entry.Attr,
+		Attributes:           fs.attr(entry),
 		Child:                entry.Inode,
 		AttributesExpiration: now.Add(time.Second),
 		EntryExpiration:      now.Add(time.Second),
@@ -368,7 +487,12 @@ func (fs *BaseFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) (err err
 	}
 	fh := fhi.(*handle)
 
+	fh.mu.Lock() // Local copy not dropped while reading
+	defer fh.mu.Unlock()
 	localFile := fh.entry.Cache(fs.Root)
+	if localFile == nil {
+		return fuse.EIO
+	}
 	op.BytesRead, err = localFile.ReadAt(op.Dst, op.Offset)
 	if err == io.EOF { // fuse does not expect a EOF
 		err = nil
@@ -380,6 +504,9 @@ func (fs *BaseFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) (err err
 // CreateFile creates empty file in google Drive and returns its ID and attributes, only allows file creation on 'My Drive'
 // Cloud SPECIFIC
 func (fs *BaseFS) CreateFile(ctx context.Context, op *fuseops.CreateFileOp) (err error) {
+	if fs.stopping() {
+		return fuseErr(ErrStopping)
+	}
 
 	parentFile := fs.Root.FindByInode(op.Parent)
 	if parentFile == nil {
@@ -402,7 +529,7 @@ func (fs *BaseFS) CreateFile(ctx context.Context, op *fuseops.CreateFileOp) (err
 	// Lock
 	fh := fs.createHandle()
 	fh.entry = entry
-	fh.uploadOnDone = true
+	fh.setDirty(true)
 	//
 	op.Handle = fh.ID
 	op.Entry = fuseops.ChildInodeEntry{
@@ -420,23 +547,33 @@ func (fs *BaseFS) CreateFile(ctx context.Context, op *fuseops.CreateFileOp) (err
 // Maybe the ReadFile should be called here aswell to cache current contents since we are using writeAt
 // CLOUD SPECIFIC
 func (fs *BaseFS) WriteFile(ctx context.Context, op *fuseops.WriteFileOp) (err error) {
+	if fs.stopping() {
+		return fuseErr(ErrStopping)
+	}
 
 	fhi, ok := fs.fileHandles.Load(op.Handle)
 	if !ok {
 		return fuse.EIO
 	}
 	fh := fhi.(*handle)
+	if IsVirtual(fh.entry.File) { // Revisions are read only
+		return fuseErr(ErrPermission)
+	}
 
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
 	localFile := fh.entry.Cache(fs.Root)
 	if localFile == nil {
 		return fuse.EINVAL
 	}
+	fh.entry.Lock() // Not while uploading
 	_, err = localFile.WriteAt(op.Data, op.Offset)
+	fh.entry.Unlock()
 	if err != nil {
 		err = fuse.EIO
 		return
 	}
-	fh.uploadOnDone = true
+	fh.setDirty(true)
 
 	return
 }
@@ -453,11 +590,9 @@ func (fs *BaseFS) FlushFile(ctx context.Context, op *fuseops.FlushFileOp) (err e
 	if fh.entry.tempFile == nil {
 		return
 	}
-	if fh.uploadOnDone { // or if content changed basically
-		err = fh.entry.Sync(fs.Root)
-		if err != nil {
-			return fuseErr(err)
-		}
+	// Upload if content changed
+	if err = fh.sync(fs.Root); err != nil {
+		return fuseErr(err)
 	}
 	return
 }
@@ -481,6 +616,9 @@ func (fs *BaseFS) ReleaseFileHandle(ctx context.Context, op *fuseops.ReleaseFile
 // Unlink remove file and remove from local cache entry
 // SPECIFIC
 func (fs *BaseFS) Unlink(ctx context.Context, op *fuseops.UnlinkOp) (err error) {
+	if fs.stopping() {
+		return fuseErr(ErrStopping)
+	}
 
 	parentEntry := fs.Root.FindByInode(op.Parent)
 	if parentEntry == nil {
@@ -498,12 +636,20 @@ func (fs *BaseFS) Unlink(ctx context.Context, op *fuseops.UnlinkOp) (err error)
 
 // MkDir creates a directory on a parent dir
 func (fs *BaseFS) MkDir(ctx context.Context, op *fuseops.MkDirOp) (err error) {
+	if fs.stopping() {
+		return fuseErr(ErrStopping)
+	}
 
 	parentFile := fs.Root.FindByInode(op.Parent)
 	if parentFile == nil {
 		return fuse.ENOENT
 	}
 
+	existsFile := fs.Root.Lookup(parentFile, op.Name)
+	if existsFile != nil {
+		return fuse.EEXIST
+	}
+
 	entry, err := fs.Root.CreateFile(parentFile, op.Name, true)
 	if err != nil {
 		return fuseErr(err)
@@ -521,6 +667,9 @@ func (fs *BaseFS) MkDir(ctx context.Context, op *fuseops.MkDirOp) (err error) {
 
 // RmDir fuse implementation
 func (fs *BaseFS) RmDir(ctx context.Context, op *fuseops.RmDirOp) (err error) {
+	if fs.stopping() {
+		return fuseErr(ErrStopping)
+	}
 
 	parentFile := fs.Root.FindByInode(op.Parent)
 	if parentFile == nil {
@@ -528,6 +677,9 @@ func (fs *BaseFS) RmDir(ctx context.Context, op *fuseops.RmDirOp) (err error) {
 	}
 
 	theFile := fs.Root.Lookup(parentFile, op.Name)
+	if theFile == nil {
+		return fuse.ENOENT
+	}
 
 	err = fs.Root.DeleteFile(theFile)
 	if err != nil {
@@ -539,6 +691,9 @@ func (fs *BaseFS) RmDir(ctx context.Context, op *fuseops.RmDirOp) (err error) {
 
 // Rename fuse implementation
 func (fs *BaseFS) Rename(ctx context.Context, op *fuseops.RenameOp) (err error) {
+	if fs.stopping() {
+		return fuseErr(ErrStopping)
+	}
 	oldParentEntry := fs.Root.FindByInode(op.OldParent)
 	if oldParentEntry == nil {
 		return fuse.ENOENT
@@ -557,11 +712,19 @@ func (fs *BaseFS) Rename(ctx context.Context, op *fuseops.RenameOp) (err error)
 	// So we prevent a rename to a file with same name
 	//existsFile := newParentFile.FindByName(op.NewName, false)
 	existsEntry := fs.Root.Lookup(newParentEntry, op.NewName)
-	if existsEntry != nil {
+	if existsEntry != nil && existsEntry != oldEntry { // Same entry on case only renames
 		return fuse.EEXIST
 	}
+	if existsEntry == oldEntry && oldEntry.Name == op.NewName { // Nothing to do
+		return
+	}
+
+	newName := fs.NameEncoder.Decode(op.NewName)
+	if op.NewName == oldEntry.Name { // Same local name, keep the original cloud name (might be shortened)
+		newName = oldEntry.File.Name
+	}
 
-	nFile, err := fs.Service.Move(oldEntry.File, newParentEntry.File, op.NewName)
+	nFile, err := fs.move(oldEntry, newParentEntry, newName, existsEntry == oldEntry)
 	if err != nil {
 		return fuseErr(err)
 	}
@@ -575,14 +738,59 @@ func (fs *BaseFS) Rename(ctx context.Context, op *fuseops.RenameOp) (err error)
 
 }
 
+// move file in service, restoring or trashing it if moved out or into trash
+func (fs *BaseFS) move(entry *FileEntry, newParentEntry *FileEntry, newName string, caseOnly bool) (*File, error) {
+	if entry.File.ID == TrashID || IsVirtual(entry.File) || IsVirtual(newParentEntry.File) {
+		return nil, ErrPermission
+	}
+	oldInTrash := fs.Root.InTrash(entry)
+	newInTrash := fs.Root.InTrash(newParentEntry)
+	if oldInTrash || newInTrash {
+		ts, ok := fs.trashService()
+		switch {
+		case !ok:
+			return nil, ErrPermission
+		case oldInTrash && !newInTrash: // Moving out of trash
+			return ts.Restore(entry.File, newParentEntry.File, newName)
+		case !oldInTrash && newParentEntry.File.ID == TrashID: // Moving into trash root
+			return ts.Trash(entry.File)
+		default:
+			return nil, ErrPermission
+		}
+	}
+
+	if !caseOnly {
+		return fs.Service.Move(entry.File, newParentEntry.File, newName)
+	}
+	// Case only rename, services might refuse it so we move through an intermediate name
+	tmpName := fmt.Sprintf("%s.cloudmount-%d", newName, time.Now().UnixNano())
+	tmpFile, err := fs.Service.Move(entry.File, newParentEntry.File, tmpName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := fs.Service.Move(tmpFile, newParentEntry.File, newName)
+	if err != nil {
+		// Back to the original name
+		if _, rerr := fs.Service.Move(tmpFile, newParentEntry.File, entry.File.Name); rerr != nil {
+			errlog.Printf("Unable to restore '%s' renamed as '%s': %v", entry.File.Name, tmpName, rerr)
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
 func fuseErr(err error) error {
-	switch err {
-	case ErrPermission:
+	switch {
+	case err == nil:
+		return nil
+	case err == ErrPermission:
 		return syscall.EPERM
-	case ErrNotImplemented:
+	case err == ErrNotImplemented:
 		return fuse.ENOSYS
-	case nil:
-		return nil
+	case err == ErrStopping:
+		return syscall.EROFS
+	case errors.Is(err, oauth2util.ErrReauth): // Credentials no longer valid
+		return syscall.EACCES
 	default:
 		return fuse.EINVAL
 	}
@@ -0,0 +1,56 @@
+package basefs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+func TestRenameCaseOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		moveErr error
+		want    string // Name in service after rename
+		moves   int
+	}{
+		{"renamed", nil, "A.txt", 2},
+		{"rollback", errors.New("refused"), "a.txt", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeService(&File{ID: "f", Name: "a.txt", Mode: 0644})
+			s.moveErr["A.txt"] = tt.moveErr
+			fs := newTestFS(t, s)
+			fs.CaseInsensitive = true
+			entry := fs.Root.LookupPath("a.txt")
+
+			err := fs.Rename(context.Background(), &fuseops.RenameOp{
+				OldParent: fuseops.RootInodeID, OldName: "a.txt",
+				NewParent: fuseops.RootInodeID, NewName: "A.txt",
+			})
+			if (err != nil) != (tt.moveErr != nil) {
+				t.Fatalf("Rename error = %v", err)
+			}
+			if tt.moveErr != nil && err != syscall.EINVAL {
+				t.Errorf("Rename error = %v, want EINVAL", err)
+			}
+			if got := s.files["f"].Name; got != tt.want {
+				t.Errorf("service name = %q, want %q", got, tt.want)
+			}
+			if strings.Contains(s.files["f"].Name, ".cloudmount-") {
+				t.Errorf("intermediate name left in service: %q", s.files["f"].Name)
+			}
+			if s.calls["Move"] != tt.moves {
+				t.Errorf("Move called %d times, want %d", s.calls["Move"], tt.moves)
+			}
+			got := fs.Root.Lookup(fs.Root.FindByInode(fuseops.RootInodeID), tt.want)
+			if got == nil || got.Name != tt.want || got.Inode != entry.Inode {
+				t.Errorf("entry after rename = %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package basefs
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gohxs/cloudmount/internal/core"
+)
+
+type fsStats struct {
+	downloads int64
+	uploads   int64
+	errors    int64
+}
+
+// transfer tracks a running upload or download, returns the func to call
+// when done
+func (fs *BaseFS) transfer(file *File, upload bool) func() {
+	t := &core.Transfer{Upload: upload, Started: time.Now()}
+	if file != nil {
+		t.Path = file.Name
+		if entry := fs.Root.FindByID(file.ID); entry != nil {
+			t.Path = fs.Root.Path(entry)
+		}
+	}
+	fs.transfers.Store(t, t)
+	if upload {
+		atomic.AddInt64(&fs.stats.uploads, 1)
+	} else {
+		atomic.AddInt64(&fs.stats.downloads, 1)
+	}
+	return func() { fs.transfers.Delete(t) }
+}
+
+type refreshRequest struct {
+	full bool
+	done chan error
+}
+
+// RefreshNow checks for changes without waiting the refresh interval, full
+// reloads the whole listing, waits until done
+func (fs *BaseFS) RefreshNow(full bool) error {
+	if fs.stopping() {
+		return ErrStopping
+	}
+	req := refreshRequest{full, make(chan error, 1)}
+	fs.refresh <- req
+	return <-req.done
+}
+
+// Reload reloads service credentials from source config
+func (fs *BaseFS) Reload() error {
+	rs, ok := fs.Service.(ReloadService)
+	if !ok {
+		log.Println("Service does not reload credentials")
+		return nil
+	}
+	return rs.Reload()
+}
+
+// Flush uploads files changed in open handles
+func (fs *BaseFS) Flush() (err error) {
+	return fs.flush(nil)
+}
+
+// flush uploads files changed in open handles, no more uploads are started
+// once abort is set
+func (fs *BaseFS) flush(abort *int32) (err error) {
+	fs.fileHandles.Range(func(k, v interface{}) bool {
+		fh := v.(*handle)
+		if abort != nil && atomic.LoadInt32(abort) != 0 {
+			return false
+		}
+		if fh.entry == nil {
+			return true
+		}
+		if serr := fh.sync(fs.Root); serr != nil {
+			atomic.AddInt64(&fs.stats.errors, 1)
+			errlog.Println("Flush:", fh.entry.Name, serr)
+			err = serr
+		}
+		return true
+	})
+	return err
+}
+
+// DropCache removes local copies of open files without pending changes,
+// they are downloaded again on next read
+func (fs *BaseFS) DropCache() int {
+	handles := map[*FileEntry][]*handle{}
+	fs.fileHandles.Range(func(k, v interface{}) bool {
+		if fh := v.(*handle); fh.entry != nil {
+			handles[fh.entry] = append(handles[fh.entry], fh)
+		}
+		return true
+	})
+	count := 0
+	for entry, hs := range handles {
+		// The local copy is shared by all handles of the entry
+		dirty := false
+		for _, fh := range hs {
+			fh.mu.Lock()
+			dirty = dirty || fh.dirty()
+		}
+		entry.Lock()
+		cached := entry.tempFile != nil
+		entry.Unlock()
+		if cached && !dirty {
+			entry.ClearCache()
+			count++
+		}
+		for _, fh := range hs {
+			fh.mu.Unlock()
+		}
+	}
+	return count
+}
+
+// dirtyEntries entries with changes not uploaded in any handle, the local
+// copy is shared by all handles of the entry
+func (fs *BaseFS) dirtyEntries() map[*FileEntry]bool {
+	ret := map[*FileEntry]bool{}
+	fs.fileHandles.Range(func(k, v interface{}) bool {
+		fh := v.(*handle)
+		if fh.entry != nil && fh.dirty() {
+			ret[fh.entry] = true
+		}
+		return true
+	})
+	return ret
+}
+
+// Handles lists open file handles
+func (fs *BaseFS) Handles() []core.HandleInfo {
+	ret := []core.HandleInfo{}
+	fs.fileHandles.Range(func(k, v interface{}) bool {
+		fh := v.(*handle)
+		if fh.entry == nil { // Directory
+			return true
+		}
+		ret = append(ret, core.HandleInfo{
+			ID:     uint64(fh.ID),
+			Path:   fs.Root.Path(fh.entry),
+			Cached: fh.entry.tempFile != nil,
+			Dirty:  fh.dirty(),
+		})
+		return true
+	})
+	return ret
+}
+
+// Transfers lists running uploads and downloads
+func (fs *BaseFS) Transfers() []core.Transfer {
+	ret := []core.Transfer{}
+	fs.transfers.Range(func(k, v interface{}) bool {
+		ret = append(ret, *v.(*core.Transfer))
+		return true
+	})
+	return ret
+}
+
+// Stats file system counters
+func (fs *BaseFS) Stats() map[string]int {
+	handles := 0
+	fs.fileHandles.Range(func(k, v interface{}) bool {
+		handles++
+		return true
+	})
+	transfers := 0
+	fs.transfers.Range(func(k, v interface{}) bool {
+		transfers++
+		return true
+	})
+	return map[string]int{
+		"entries":   fs.Root.Count(),
+		"handles":   handles,
+		"transfers": transfers,
+		"downloads": int(atomic.LoadInt64(&fs.stats.downloads)),
+		"uploads":   int(atomic.LoadInt64(&fs.stats.uploads)),
+		"errors":    int(atomic.LoadInt64(&fs.stats.errors)),
+	}
+}
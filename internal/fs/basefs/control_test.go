@@ -0,0 +1,52 @@
+package basefs
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+func TestDropCacheWhileReading(t *testing.T) {
+	s := newFakeService(&File{ID: "f", Name: "a.txt", Mode: 0644, Size: 5})
+	s.content["f"] = []byte("hello")
+	fs := newTestFS(t, s)
+	entry := fs.Root.LookupPath("a.txt")
+
+	handles := []fuseops.HandleID{}
+	for i := 0; i < 2; i++ {
+		op := &fuseops.OpenFileOp{Inode: entry.Inode}
+		if err := fs.OpenFile(context.Background(), op); err != nil {
+			t.Fatal(err)
+		}
+		handles = append(handles, op.Handle)
+	}
+
+	wg := sync.WaitGroup{}
+	for _, h := range handles {
+		wg.Add(1)
+		go func(h fuseops.HandleID) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				op := &fuseops.ReadFileOp{Handle: h, Dst: make([]byte, 5)}
+				if err := fs.ReadFile(context.Background(), op); err != nil || string(op.Dst[:op.BytesRead]) != "hello" {
+					t.Errorf("read = %q, %v", op.Dst[:op.BytesRead], err)
+					return
+				}
+			}
+		}(h)
+	}
+	for i := 0; i < 200; i++ {
+		fs.DropCache()
+	}
+	wg.Wait()
+
+	// Dirty copies are kept
+	fhi, _ := fs.fileHandles.Load(handles[0])
+	fhi.(*handle).setDirty(true)
+	entry.Cache(fs.Root)
+	if n := fs.DropCache(); n != 0 || entry.tempFile == nil {
+		t.Errorf("DropCache dropped %d dirty copies", n)
+	}
+}
@@ -15,6 +15,7 @@ type File struct {
 	AccessedTime time.Time
 	Mode         os.FileMode
 	Parents      []string
+	Link         string      // Target file ID if Mode is os.ModeSymlink
 	Data         interface{} // Any thing
 }
 
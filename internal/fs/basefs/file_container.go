@@ -1,7 +1,6 @@
 package basefs
 
 import (
-	"fmt"
 	"math"
 	"os"
 	"strings"
@@ -62,6 +61,11 @@ func (fc *FileContainer) FindByID(id string) *FileEntry {
 	fc.inodeMU.Lock()
 	defer fc.inodeMU.Unlock()
 
+	return fc.findByID(id)
+}
+
+// non lock findByID
+func (fc *FileContainer) findByID(id string) *FileEntry {
 	for _, v := range fc.fileEntries {
 		if v.File == nil && id == "" {
 			log.Println("Found cause file is nil and id '' inode:", v.Inode)
@@ -79,12 +83,19 @@ func (fc *FileContainer) Lookup(parent *FileEntry, name string) *FileEntry {
 	fc.inodeMU.Lock()
 	defer fc.inodeMU.Unlock()
 
+	var found *FileEntry
 	for _, entry := range fc.fileEntries {
-		if entry.HasParent(parent) && entry.Name == name {
+		if !entry.HasParent(parent) {
+			continue
+		}
+		if entry.Name == name { // Exact match first
 			return entry
 		}
+		if fc.fs.CaseInsensitive && found == nil && strings.EqualFold(entry.Name, name) {
+			found = entry
+		}
 	}
-	return nil
+	return found
 }
 
 //ListByParent entries from parent
@@ -102,10 +113,30 @@ func (fc *FileContainer) ListByParent(parent *FileEntry) []*FileEntry {
 
 }
 
+//InTrash checks if entry is the trash dir or is inside it
+func (fc *FileContainer) InTrash(entry *FileEntry) bool {
+	fc.inodeMU.Lock()
+	defer fc.inodeMU.Unlock()
+
+	for depth := 0; entry != nil && entry.File != nil && depth < len(fc.fileEntries); depth++ {
+		if entry.File.ID == TrashID {
+			return true
+		}
+		if len(entry.File.Parents) == 0 {
+			return false
+		}
+		entry = fc.findByID(entry.File.Parents[0])
+	}
+	return false
+}
+
 //CreateFile tell service to create a file
 func (fc *FileContainer) CreateFile(parentFile *FileEntry, name string, isDir bool) (*FileEntry, error) {
+	if fc.InTrash(parentFile) || IsVirtual(parentFile.File) { // No new files in trash or versions
+		return nil, ErrPermission
+	}
 
-	createdFile, err := fc.fs.Service.Create(parentFile.File, name, isDir)
+	createdFile, err := fc.fs.Service.Create(parentFile.File, fc.fs.NameEncoder.Decode(name), isDir)
 	if err != nil {
 		return nil, err
 	}
@@ -114,8 +145,22 @@ func (fc *FileContainer) CreateFile(parentFile *FileEntry, name string, isDir bo
 	return entry, nil
 }
 
-//DeleteFile tell service to delete a file
+//DeleteFile tell service to delete a file, the file is moved to trash if
+// supported and purged if it is already in trash
 func (fc *FileContainer) DeleteFile(entry *FileEntry) error {
+	if entry.File != nil && (entry.File.ID == TrashID || IsVirtual(entry.File)) {
+		return ErrPermission
+	}
+	if ts, ok := fc.fs.trashService(); ok && !fc.InTrash(entry) {
+		trashedFile, err := ts.Trash(entry.File)
+		if err != nil {
+			return err
+		}
+		fc.RemoveEntry(entry)
+		fc.FileEntry(trashedFile, entry.Inode) // Same inode, now in trash
+		return nil
+	}
+
 	fc.inodeMU.Lock()
 	defer fc.inodeMU.Unlock()
 
@@ -154,9 +199,11 @@ func (fc *FileContainer) FileEntry(file *File, inodeOps ...fuseops.InodeID) *Fil
 	////////////////////////////////////
 	name := ""
 	if file != nil {
-		name = file.Name
+		/////////////////////////////////////////////////////////////
+		// Important some cloud services might support insane chars
+		////////////////////////////////////
+		name = fc.fs.NameEncoder.Encode(file.Name)
 		count := 1
-		nameParts := strings.Split(name, ".")
 		for {
 			// We find if we have a GFile in same parent with same name
 			var entry *FileEntry
@@ -171,22 +218,10 @@ func (fc *FileContainer) FileEntry(file *File, inodeOps ...fuseops.InodeID) *Fil
 				break
 			}
 			count++
-			if len(nameParts) > 1 {
-				name = fmt.Sprintf("%s(%d).%s", nameParts[0], count, strings.Join(nameParts[1:], "."))
-			} else {
-				name = fmt.Sprintf("%s(%d)", nameParts[0], count)
-			}
+			name = fc.fs.NameEncoder.Duplicate(file.Name, count)
 			log.Printf("Conflicting name generated new '%s' as '%s'", file.Name, name)
 		}
 	}
-	/////////////////////////////////////////////////////////////
-	// Important some cloud services might support insane chars
-	////////////////////////////////////
-	if strings.Contains(name, "/") { // Something to inform user
-		newName := strings.Replace(name, "/", "_", -1)
-		log.Printf("Filename contains invalid chars, sanitizing: '%s'-'%s'", name, newName)
-		name = newName
-	}
 	fe := &FileEntry{
 		Inode: inode,
 		Name:  name,
@@ -113,7 +113,9 @@ func (fe *FileEntry) Sync(fc *FileContainer) (err error) {
 	fe.tempFile.Sync()
 	fe.tempFile.Seek(0, io.SeekStart) // Depends??, for reading?
 
+	done := fc.fs.transfer(fe.File, true)
 	upFile, err := fc.fs.Service.Upload(fe.tempFile, fe.File)
+	done()
 	if err != nil {
 		return err
 	}
@@ -139,11 +141,16 @@ func (fe *FileEntry) Cache(fc *FileContainer) *FileWrapper {
 	}
 	fe.tempFile = &FileWrapper{localFile}
 
-	err = fc.fs.Service.DownloadTo(fe.tempFile, fe.File)
+	err = fc.fs.downloadTo(fe.tempFile, fe.File)
 	// ignore download since can be a bogus file, for certain file systems
 	//if err != nil { // Ignore this error
 	//    return nil
 	//}
+	if err == nil { // Some services only know the size after download (i.e: exported docs)
+		if st, err := fe.tempFile.Stat(); err == nil {
+			fe.Attr.Size = uint64(st.Size())
+		}
+	}
 
 	// tempFile could change to null in the meantime (download might take long?)
 	fe.tempFile.Seek(0, io.SeekStart)
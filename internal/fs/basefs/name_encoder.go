@@ -0,0 +1,138 @@
+package basefs
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Linux limit for a single path component in bytes
+const maxNameLen = 255
+
+// Lookalike runes used to represent chars that linux can't hold in a filename
+// quoteRune is placed before a literal lookalike so the encoding is reversible
+const (
+	slashRune = '／' // U+FF0F FULLWIDTH SOLIDUS
+	nulRune   = '␀' // U+2400 SYMBOL FOR NULL
+	quoteRune = '‛' // U+201B SINGLE HIGH-REVERSED-9 QUOTATION MARK
+)
+
+// Name encodings
+const (
+	// EncodingUnicode maps invalid chars to unicode lookalikes (reversible)
+	EncodingUnicode = "unicode"
+	// EncodingUnderscore replaces invalid chars with '_' (one way, old behaviour)
+	EncodingUnderscore = "underscore"
+)
+
+// Long name strategies
+const (
+	// LongNamesHash truncates and appends a short hash of the original name
+	LongNamesHash = "hash"
+	// LongNamesTruncate truncates names, conflicts are handled as duplicates
+	LongNamesTruncate = "truncate"
+)
+
+// NameEncoder translates cloud file names into names linux can represent and back
+type NameEncoder struct {
+	Encoding  string
+	LongNames string
+}
+
+// Encode converts a cloud name into a local name
+func (ne NameEncoder) Encode(name string) string {
+	ret := ne.escape(name)
+	if ret != name {
+		log.Printf("Filename contains invalid chars, encoding: '%s'-'%s'", name, ret)
+	}
+	return ne.shorten(ret, maxNameLen)
+}
+
+// Duplicate returns the local name of the count-th file named name in a
+// folder (i.e: 'file(2).txt'), room for the index is kept when shortening
+func (ne NameEncoder) Duplicate(name string, count int) string {
+	index := fmt.Sprintf("(%d)", count)
+	local := ne.shorten(ne.escape(name), maxNameLen-len(index))
+	if parts := strings.SplitN(local, ".", 2); len(parts) > 1 {
+		return parts[0] + index + "." + parts[1]
+	}
+	return local + index
+}
+
+// escape replaces the chars linux can't hold in a filename
+func (ne NameEncoder) escape(name string) string {
+	var ret string
+	switch ne.Encoding {
+	case EncodingUnderscore:
+		ret = strings.NewReplacer("/", "_", "\x00", "_").Replace(name)
+	default:
+		buf := &strings.Builder{}
+		for _, r := range name {
+			switch r {
+			case '/':
+				buf.WriteRune(slashRune)
+			case 0:
+				buf.WriteRune(nulRune)
+			case slashRune, nulRune, quoteRune: // Literal lookalikes are quoted
+				buf.WriteRune(quoteRune)
+				buf.WriteRune(r)
+			default:
+				buf.WriteRune(r)
+			}
+		}
+		ret = buf.String()
+	}
+	return ret
+}
+
+// Decode converts a local name into the cloud name
+func (ne NameEncoder) Decode(name string) string {
+	if ne.Encoding == EncodingUnderscore { // Not reversible
+		return name
+	}
+	buf := &strings.Builder{}
+	quoted := false
+	for _, r := range name {
+		if quoted {
+			buf.WriteRune(r)
+			quoted = false
+			continue
+		}
+		switch r {
+		case quoteRune:
+			quoted = true
+		case slashRune:
+			buf.WriteRune('/')
+		case nulRune:
+			buf.WriteRune(0)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// shorten names longer than max bytes, keeping the extension
+func (ne NameEncoder) shorten(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) > max/4 { // Not a real extension
+		ext = ""
+	}
+	suffix := ext
+	if ne.LongNames != LongNamesTruncate {
+		sum := sha1.Sum([]byte(name))
+		suffix = fmt.Sprintf("~%x%s", sum[:4], ext)
+	}
+	base := name[:max-len(suffix)]
+	for len(base) > 0 && !utf8.RuneStart(name[len(base)]) { // Do not split runes
+		base = base[:len(base)-1]
+	}
+	ret := base + suffix
+	log.Printf("Filename too long, shortening: '%s'-'%s'", name, ret)
+	return ret
+}
@@ -0,0 +1,118 @@
+package basefs
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNameEncoderEncode(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	tests := []struct {
+		name    string
+		encoder NameEncoder
+		in      string
+		want    string
+	}{
+		{"plain", NameEncoder{}, "report.txt", "report.txt"},
+		{"slash", NameEncoder{}, "a/b.txt", "a／b.txt"},
+		{"nul", NameEncoder{}, "a\x00b", "a␀b"},
+		{"literal lookalike", NameEncoder{}, "a／b", "a‛／b"},
+		{"literal quote", NameEncoder{}, "a‛b", "a‛‛b"},
+		{"underscore", NameEncoder{Encoding: EncodingUnderscore}, "a/b\x00c", "a_b_c"},
+		{"max length", NameEncoder{}, long[:255], long[:255]},
+		{"truncate", NameEncoder{LongNames: LongNamesTruncate}, long + ".txt", long[:251] + ".txt"},
+		{"truncate no extension", NameEncoder{LongNames: LongNamesTruncate}, long, long[:255]},
+		{"long extension", NameEncoder{LongNames: LongNamesTruncate}, "a." + long, ("a." + long)[:255]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.encoder.Encode(tt.in); got != tt.want {
+				t.Errorf("Encode(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameEncoderLongNames(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		ext  string
+	}{
+		{"ascii", strings.Repeat("a", 300) + ".txt", ".txt"},
+		{"multibyte", strings.Repeat("ç", 200) + ".txt", ".txt"},
+		{"encoded", strings.Repeat("/", 100), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NameEncoder{}.Encode(tt.in)
+			if len(got) > maxNameLen || !utf8.ValidString(got) {
+				t.Errorf("Encode = %q (%d bytes)", got, len(got))
+			}
+			if !strings.HasSuffix(got, tt.ext) || !strings.Contains(got, "~") {
+				t.Errorf("Encode = %q, want hash and %q extension", got, tt.ext)
+			}
+			if other := (NameEncoder{}).Encode(tt.in + "x"); other == got {
+				t.Errorf("different names shortened to %q", got)
+			}
+		})
+	}
+}
+
+func TestNameEncoderDecode(t *testing.T) {
+	names := []string{
+		"report.txt",
+		"a/b/c",
+		"a\x00b",
+		"a／b", // Literal lookalikes
+		"a␀b",
+		"a‛b",
+		"‛/‛‛／",
+		"ünïcode/名前",
+	}
+	for _, name := range names {
+		local := NameEncoder{}.Encode(name)
+		if strings.ContainsAny(local, "/\x00") {
+			t.Errorf("Encode(%q) = %q has invalid chars", name, local)
+		}
+		if got := (NameEncoder{}).Decode(local); got != name {
+			t.Errorf("Decode(Encode(%q)) = %q", name, got)
+		}
+	}
+	if got := (NameEncoder{Encoding: EncodingUnderscore}).Decode("a_b"); got != "a_b" {
+		t.Errorf("underscore Decode = %q", got)
+	}
+}
+
+func TestNameEncoderDuplicate(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	tests := []struct {
+		name    string
+		encoder NameEncoder
+		in      string
+		count   int
+		want    string
+	}{
+		{"extension", NameEncoder{}, "file.tar.gz", 2, "file(2).tar.gz"},
+		{"no extension", NameEncoder{}, "file", 3, "file(3)"},
+		{"encoded", NameEncoder{}, "a/b.txt", 2, "a／b(2).txt"},
+		{"truncate", NameEncoder{LongNames: LongNamesTruncate}, long + ".txt", 12, long[:247] + "(12).txt"},
+		{"truncate no extension", NameEncoder{LongNames: LongNamesTruncate}, long, 2, long[:252] + "(2)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.encoder.Duplicate(tt.in, tt.count); got != tt.want {
+				t.Errorf("Duplicate(%q, %d) = %q, want %q", tt.in, tt.count, got, tt.want)
+			}
+		})
+	}
+
+	// Long names with hash keep the index within the limit
+	for count := 2; count < 1000; count *= 7 {
+		got := NameEncoder{}.Duplicate(long+".txt", count)
+		if len(got) > maxNameLen || !strings.HasSuffix(got, ").txt") {
+			t.Errorf("Duplicate(long, %d) = %q (%d bytes)", count, got, len(got))
+		}
+	}
+}
@@ -8,7 +8,7 @@ import (
 
 // Service interface
 type Service interface {
-	Changes() ([]*Change, error)
+	Changes() ([]*Change, error) // Changes returned with an error are applied too
 	ListAll() ([]*File, error)
 	Create(parent *File, name string, isDir bool) (*File, error)
 	//Truncate(file *File) (*File, error)
@@ -19,3 +19,35 @@ type Service interface {
 	//-- implementing
 	StatFS(*fuseops.StatFSOp) error
 }
+
+// TrashService implemented by services that can move files to a trash bin
+// instead of deleting them, Service.Delete is then used to purge
+type TrashService interface {
+	// Trash moves file to trash, returned file must be parented on TrashID
+	Trash(file *File) (*File, error)
+	// ListTrash lists trashed files, top level items must be parented on TrashID
+	ListTrash() ([]*File, error)
+	// Restore moves a trashed file out of trash into newParent
+	Restore(file *File, newParent *File, name string) (*File, error)
+}
+
+// LinkService implemented by services that can create links to files
+type LinkService interface {
+	// CreateLink creates a link in parent pointing to target, returned file
+	// must have os.ModeSymlink and Link set to target ID, target is nil for root
+	CreateLink(parent *File, name string, target *File) (*File, error)
+}
+
+// ReloadService implemented by services that can reload credentials from
+// the source config while mounted (i.e: rotated secrets)
+type ReloadService interface {
+	Reload() error
+}
+
+// RevisionService implemented by services that keep file revisions
+type RevisionService interface {
+	// Revisions lists revisions of file, ID must identify the revision
+	Revisions(file *File) ([]*File, error)
+	// DownloadRevisionTo downloads a file revision to a writer
+	DownloadRevisionTo(w io.Writer, file *File, revision *File) error
+}
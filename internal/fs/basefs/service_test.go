@@ -0,0 +1,131 @@
+package basefs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/gohxs/cloudmount/internal/core"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// fakeService in memory Service, also a RevisionService
+type fakeService struct {
+	files     map[string]*File
+	content   map[string][]byte
+	revisions map[string][]*File // Revisions by file ID
+	calls     map[string]int     // Calls by method
+	moveErr   map[string]error   // Move errors by new name
+	lastID    int
+}
+
+func newFakeService(files ...*File) *fakeService {
+	s := &fakeService{
+		files:     map[string]*File{},
+		content:   map[string][]byte{},
+		revisions: map[string][]*File{},
+		calls:     map[string]int{},
+		moveErr:   map[string]error{},
+	}
+	for _, f := range files {
+		s.files[f.ID] = f
+	}
+	return s
+}
+
+// newTestFS returns a loaded BaseFS over s
+func newTestFS(t *testing.T, s Service) *BaseFS {
+	fs := New(&core.Core{})
+	fs.Service = s
+	if err := fs.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func (s *fakeService) call(name string) {
+	s.calls[name]++
+}
+
+func (s *fakeService) Changes() ([]*Change, error) { return nil, nil }
+
+func (s *fakeService) ListAll() ([]*File, error) {
+	s.call("ListAll")
+	ret := []*File{}
+	for _, f := range s.files {
+		c := *f
+		ret = append(ret, &c)
+	}
+	return ret, nil
+}
+
+func (s *fakeService) Create(parent *File, name string, isDir bool) (*File, error) {
+	s.call("Create")
+	s.lastID++
+	f := &File{ID: fmt.Sprint("new", s.lastID), Name: name, Mode: 0644, Parents: parents(parent)}
+	if isDir {
+		f.Mode = 0755 | os.ModeDir
+	}
+	s.files[f.ID] = f
+	return f, nil
+}
+
+func (s *fakeService) Upload(reader io.Reader, file *File) (*File, error) {
+	s.call("Upload")
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	s.content[file.ID] = data
+	f := *s.files[file.ID]
+	f.Size = uint64(len(data))
+	s.files[file.ID] = &f
+	return &f, nil
+}
+
+func (s *fakeService) DownloadTo(w io.Writer, file *File) error {
+	s.call("DownloadTo")
+	_, err := io.Copy(w, bytes.NewReader(s.content[file.ID]))
+	return err
+}
+
+func (s *fakeService) Move(file *File, newParent *File, name string) (*File, error) {
+	s.call("Move")
+	if err := s.moveErr[name]; err != nil {
+		return nil, err
+	}
+	f := *s.files[file.ID]
+	f.Name, f.Parents = name, parents(newParent)
+	s.files[file.ID] = &f
+	return &f, nil
+}
+
+func (s *fakeService) Delete(file *File) error {
+	s.call("Delete")
+	delete(s.files, file.ID)
+	return nil
+}
+
+func (s *fakeService) StatFS(*fuseops.StatFSOp) error { return nil }
+
+func (s *fakeService) Revisions(file *File) ([]*File, error) {
+	s.call("Revisions")
+	return s.revisions[file.ID], nil
+}
+
+func (s *fakeService) DownloadRevisionTo(w io.Writer, file *File, revision *File) error {
+	s.call("DownloadRevisionTo")
+	_, err := io.WriteString(w, revision.ID)
+	return err
+}
+
+// parents of a file in parent, root files have none
+func parents(parent *File) []string {
+	if parent == nil {
+		return nil
+	}
+	return []string{parent.ID}
+}
@@ -0,0 +1,87 @@
+package basefs
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func (fs *BaseFS) stopping() bool {
+	return atomic.LoadInt32(&fs.stopped) != 0
+}
+
+func (fs *BaseFS) uploading() bool {
+	for _, t := range fs.Transfers() {
+		if t.Upload {
+			return true
+		}
+	}
+	return false
+}
+
+// Stop refuses new changes and pauses checking for changes, uploads files
+// with pending changes waiting up to timeout and removes local copies, files
+// not saved are reported in the error and their local copy is kept
+func (fs *BaseFS) Stop(timeout time.Duration) error {
+	if !atomic.CompareAndSwapInt32(&fs.stopped, 0, 1) {
+		return nil
+	}
+
+	var abort int32
+	done := make(chan struct{})
+	go func() {
+		fs.flush(&abort) // Failures are reported as not saved
+		// Uploads already running (i.e: on close)
+		for fs.uploading() && atomic.LoadInt32(&abort) == 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		atomic.StoreInt32(&abort, 1) // Running uploads go on but are reported
+		errlog.Println("Timeout waiting for uploads after", timeout)
+	}
+
+	uploading := map[string]bool{}
+	for _, t := range fs.Transfers() {
+		if t.Upload {
+			uploading[t.Path] = true
+		}
+	}
+	unsaved := []string{}
+	reported := map[*FileEntry]bool{}
+	dirty := fs.dirtyEntries()
+	fs.fileHandles.Range(func(k, v interface{}) bool {
+		fh := v.(*handle)
+		if fh.entry == nil {
+			return true
+		}
+		if !dirty[fh.entry] {
+			fh.entry.ClearCache()
+			return true
+		}
+		if !fh.dirty() || fh.entry.tempFile == nil || reported[fh.entry] {
+			return true
+		}
+		reported[fh.entry] = true
+		path := fs.Root.Path(fh.entry)
+		state := "local copy " + fh.entry.tempFile.Name()
+		if uploading[path] {
+			state = "uploading, " + state
+		}
+		unsaved = append(unsaved, fmt.Sprintf("%s (%s)", path, state))
+		return true
+	})
+	if len(unsaved) > 0 {
+		return fmt.Errorf("not saved: %s", strings.Join(unsaved, ", "))
+	}
+	return nil
+}
+
+// Resume accepts changes again after Stop, if still mounted
+func (fs *BaseFS) Resume() {
+	atomic.StoreInt32(&fs.stopped, 0)
+}
@@ -0,0 +1,140 @@
+package basefs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// Symlinks are files with os.ModeSymlink and the target file ID in File.Link,
+// the target path is resolved in the mount when the link is read
+
+// IsSymlink returns true if entry is a symbolic link
+func (fe *FileEntry) IsSymlink() bool {
+	return fe.Attr.Mode&os.ModeSymlink == os.ModeSymlink
+}
+
+// ReadSymlink returns the path of the link target relative to the link
+func (fs *BaseFS) ReadSymlink(ctx context.Context, op *fuseops.ReadSymlinkOp) (err error) {
+	entry := fs.Root.FindByInode(op.Inode)
+	if entry == nil || entry.File == nil || entry.File.Link == "" {
+		return fuse.EINVAL
+	}
+	op.Target, err = fs.linkTarget(entry)
+	return
+}
+
+// linkTarget returns the path of the link target relative to the link
+func (fs *BaseFS) linkTarget(entry *FileEntry) (string, error) {
+	target := fs.Root.FindByID(entry.File.Link)
+	if target == nil { // Target not visible in mount
+		return "", fuse.ENOENT
+	}
+	rel, err := filepath.Rel(filepath.Dir(fs.Root.Path(entry)), fs.Root.Path(target))
+	if err != nil {
+		return "", fuse.EIO
+	}
+	return rel, nil
+}
+
+// attr returns entry attributes, the size of symlinks is the length of the
+// target path as lstat reports it
+func (fs *BaseFS) attr(entry *FileEntry) fuseops.InodeAttributes {
+	attr := entry.Attr
+	if entry.IsSymlink() && entry.File != nil && entry.File.Link != "" {
+		if target, err := fs.linkTarget(entry); err == nil {
+			attr.Size = uint64(len(target))
+		}
+	}
+	return attr
+}
+
+// CreateSymlink creates a link in services that support it, target must be
+// an existing path in the mount
+func (fs *BaseFS) CreateSymlink(ctx context.Context, op *fuseops.CreateSymlinkOp) (err error) {
+	if fs.stopping() {
+		return fuseErr(ErrStopping)
+	}
+	ls, ok := fs.Service.(LinkService)
+	if !ok {
+		return fuse.ENOSYS
+	}
+	parentFile := fs.Root.FindByInode(op.Parent)
+	if parentFile == nil {
+		return fuse.ENOENT
+	}
+	if fs.Root.Lookup(parentFile, op.Name) != nil {
+		return fuse.EEXIST
+	}
+	if fs.Root.InTrash(parentFile) || IsVirtual(parentFile.File) {
+		return syscall.EPERM
+	}
+
+	targetPath := op.Target
+	if !filepath.IsAbs(targetPath) {
+		targetPath = filepath.Join(fs.Root.Path(parentFile), targetPath)
+	} else if rel, err := filepath.Rel(fs.Config.Target, targetPath); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+		targetPath = "/" + rel
+	} else { // Outside of mount
+		return syscall.EPERM
+	}
+	target := fs.Root.LookupPath(targetPath)
+	if target == nil {
+		return fuse.ENOENT
+	}
+	if IsVirtual(target.File) {
+		return syscall.EPERM
+	}
+
+	linkFile, err := ls.CreateLink(parentFile.File, fs.NameEncoder.Decode(op.Name), target.File)
+	if err != nil {
+		return fuseErr(err)
+	}
+	entry := fs.Root.FileEntry(linkFile)
+
+	op.Entry = fuseops.ChildInodeEntry{
+		Attributes:           fs.attr(entry),
+		Child:                entry.Inode,
+		AttributesExpiration: time.Now().Add(time.Minute),
+		EntryExpiration:      time.Now().Add(time.Minute),
+	}
+	return
+}
+
+// Path returns the path of entry from mount root
+func (fc *FileContainer) Path(entry *FileEntry) string {
+	fc.inodeMU.Lock()
+	defer fc.inodeMU.Unlock()
+
+	names := []string{}
+	for depth := 0; entry != nil && entry.Inode != fuseops.RootInodeID && depth < len(fc.fileEntries); depth++ {
+		names = append([]string{entry.Name}, names...)
+		if entry.File == nil || len(entry.File.Parents) == 0 {
+			break
+		}
+		entry = fc.findByID(entry.File.Parents[0])
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+// LookupPath retrieves an entry by its path from mount root
+func (fc *FileContainer) LookupPath(p string) *FileEntry {
+	entry := fc.FindByInode(fuseops.RootInodeID)
+	for _, name := range strings.Split(filepath.Clean(p), "/") {
+		if name == "" {
+			continue
+		}
+		entry = fc.Lookup(entry, name)
+		if entry == nil {
+			return nil
+		}
+	}
+	return entry
+}
@@ -0,0 +1,31 @@
+package basefs
+
+import (
+	"os"
+	"time"
+)
+
+// TrashID parent ID of top level trashed files, also the name of the virtual trash dir
+const TrashID = ".Trash"
+
+// trashService returns the service trash implementation if enabled
+func (fs *BaseFS) trashService() (TrashService, bool) {
+	if !fs.Config.Options.Trash {
+		return nil, false
+	}
+	ts, ok := fs.Service.(TrashService)
+	return ts, ok
+}
+
+// trashDir virtual directory in mount root listing trashed files
+func trashDir() *File {
+	now := time.Now()
+	return &File{
+		ID:           TrashID,
+		Name:         TrashID,
+		CreatedTime:  now,
+		ModifiedTime: now,
+		AccessedTime: now,
+		Mode:         os.FileMode(0755) | os.ModeDir,
+	}
+}
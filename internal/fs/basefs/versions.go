@@ -0,0 +1,195 @@
+package basefs
+
+import (
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Revisions are exposed on demand in a virtual dir inside each folder as
+//   dir/.versions/file.txt/2006-01-02T15:04:05_rev
+// the .versions dir is not listed to prevent tools from walking all revisions
+const (
+	versionsName = ".versions"
+	// ID prefixes for the virtual entries
+	versionsPrefix     = ".versions:"
+	versionsDirPrefix  = versionsPrefix + "dir:"
+	versionsFilePrefix = versionsPrefix + "file:"
+	versionsRevPrefix  = versionsPrefix + "rev:"
+	// Revision name time format
+	versionsTimeFormat = "2006-01-02T15:04:05"
+)
+
+// revisionData stored in virtual revision entries
+type revisionData struct {
+	File     *File // Live file
+	Revision *File // Service revision
+}
+
+// IsVirtual returns true if file is a basefs virtual versions entry
+func IsVirtual(file *File) bool {
+	return file != nil && strings.HasPrefix(file.ID, versionsPrefix)
+}
+
+// revisionService returns the service revision implementation if any
+func (fs *BaseFS) revisionService() (RevisionService, bool) {
+	rs, ok := fs.Service.(RevisionService)
+	return rs, ok
+}
+
+// downloadTo downloads live files or revisions into w
+func (fs *BaseFS) downloadTo(w io.Writer, file *File) error {
+	defer fs.transfer(file, false)()
+	if rd, ok := file.Data.(*revisionData); ok {
+		rs, ok := fs.revisionService()
+		if !ok {
+			return ErrNotImplemented
+		}
+		return rs.DownloadRevisionTo(w, rd.File, rd.Revision)
+	}
+	return fs.Service.DownloadTo(w, file)
+}
+
+// versionsLookup resolves virtual entries not found on regular lookup
+func (fs *BaseFS) versionsLookup(parent *FileEntry, name string) *FileEntry {
+	if _, ok := fs.revisionService(); !ok || !parent.IsDir() {
+		return nil
+	}
+	switch {
+	case name == versionsName && !IsVirtual(parent.File) && !fs.Root.InTrash(parent):
+		return fs.versionsDir(parent)
+	case parent.File != nil && strings.HasPrefix(parent.File.ID, versionsDirPrefix):
+		dir := fs.Root.FindByID(strings.TrimPrefix(parent.File.ID, versionsDirPrefix))
+		if dir == nil {
+			return nil
+		}
+		entry := fs.Root.Lookup(dir, name)
+		if entry == nil || entry.IsDir() || IsVirtual(entry.File) {
+			return nil
+		}
+		return fs.versionsFileDir(parent, entry)
+	case parent.File != nil && strings.HasPrefix(parent.File.ID, versionsFilePrefix):
+		fs.loadRevisions(parent)
+		return fs.Root.Lookup(parent, name)
+	}
+	return nil
+}
+
+// versionsList populates virtual dirs before listing
+func (fs *BaseFS) versionsList(entry *FileEntry) {
+	if entry.File == nil {
+		return
+	}
+	switch {
+	case strings.HasPrefix(entry.File.ID, versionsDirPrefix):
+		dir := fs.Root.FindByID(strings.TrimPrefix(entry.File.ID, versionsDirPrefix))
+		if dir == nil {
+			return
+		}
+		for _, child := range fs.Root.ListByParent(dir) {
+			if child.IsDir() || IsVirtual(child.File) {
+				continue
+			}
+			fs.versionsFileDir(entry, child)
+		}
+	case strings.HasPrefix(entry.File.ID, versionsFilePrefix):
+		fs.loadRevisions(entry)
+	}
+}
+
+// versionsDir virtual .versions entry for dir
+func (fs *BaseFS) versionsDir(dir *FileEntry) *FileEntry {
+	dirID := ""
+	parents := []string{}
+	if dir.File != nil {
+		dirID = dir.File.ID
+		parents = []string{dirID}
+	}
+	id := versionsDirPrefix + dirID
+	if entry := fs.Root.FindByID(id); entry != nil {
+		return entry
+	}
+	return fs.Root.FileEntry(&File{
+		ID:           id,
+		Name:         versionsName,
+		CreatedTime:  dir.Attr.Crtime,
+		ModifiedTime: dir.Attr.Mtime,
+		AccessedTime: dir.Attr.Atime,
+		Mode:         os.FileMode(0555) | os.ModeDir,
+		Parents:      parents,
+	})
+}
+
+// versionsFileDir virtual dir holding revisions of entry
+func (fs *BaseFS) versionsFileDir(versionsDir *FileEntry, entry *FileEntry) *FileEntry {
+	id := versionsFilePrefix + entry.File.ID
+	if fileDir := fs.Root.FindByID(id); fileDir != nil {
+		return fileDir
+	}
+	return fs.Root.FileEntry(&File{
+		ID:           id,
+		Name:         entry.File.Name, // Original name, encoded again by FileEntry
+		CreatedTime:  entry.File.CreatedTime,
+		ModifiedTime: entry.File.ModifiedTime,
+		AccessedTime: entry.File.AccessedTime,
+		Mode:         os.FileMode(0555) | os.ModeDir,
+		Parents:      []string{versionsDir.File.ID},
+		Data:         entry.File,
+	})
+}
+
+// loadRevisions fetch revisions from service into the file versions dir,
+// revisions are loaded again after the refresh interval and entries of
+// removed revisions dropped
+func (fs *BaseFS) loadRevisions(fileDir *FileEntry) {
+	rs, ok := fs.revisionService()
+	if !ok {
+		return
+	}
+	file, ok := fileDir.File.Data.(*File)
+	if !ok {
+		return
+	}
+	if loaded, ok := fs.revisions.Load(fileDir.File.ID); ok && time.Since(loaded.(time.Time)) < fs.Config.Refresh() {
+		return
+	}
+	revisions, err := rs.Revisions(file)
+	if err != nil {
+		errlog.Println("Error listing revisions:", err)
+		return
+	}
+	fs.revisions.Store(fileDir.File.ID, time.Now())
+
+	ids := map[string]bool{}
+	for _, rev := range revisions {
+		ids[versionsRevPrefix+file.ID+":"+rev.ID] = true
+	}
+	for _, entry := range fs.Root.ListByParent(fileDir) {
+		if !ids[entry.File.ID] {
+			fs.Root.RemoveEntry(entry)
+		}
+	}
+	for _, rev := range revisions {
+		id := versionsRevPrefix + file.ID + ":" + rev.ID
+		if fs.Root.FindByID(id) != nil {
+			continue
+		}
+		fs.Root.FileEntry(&File{
+			ID:           id,
+			Name:         rev.ModifiedTime.UTC().Format(versionsTimeFormat) + "_" + rev.ID,
+			Size:         rev.Size,
+			CreatedTime:  rev.ModifiedTime,
+			ModifiedTime: rev.ModifiedTime,
+			AccessedTime: rev.ModifiedTime,
+			Mode:         os.FileMode(0444),
+			Parents:      []string{fileDir.File.ID},
+			Data:         &revisionData{File: file, Revision: rev},
+		})
+	}
+}
+
+// hiddenEntry entries not shown in dir listings
+func hiddenEntry(entry *FileEntry) bool {
+	return entry.File != nil && strings.HasPrefix(entry.File.ID, versionsDirPrefix)
+}
@@ -0,0 +1,55 @@
+package basefs
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRevisionsCache(t *testing.T) {
+	s := newFakeService(
+		&File{ID: "dir", Name: "docs", Mode: 0755 | os.ModeDir},
+		&File{ID: "f", Name: "a.txt", Mode: 0644, Parents: []string{"dir"}},
+	)
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.revisions["f"] = []*File{{ID: "r1", ModifiedTime: modified}, {ID: "r2", ModifiedTime: modified.Add(time.Hour)}}
+	fs := newTestFS(t, s)
+	fs.Config.SetRefresh(time.Hour)
+
+	dir := fs.Root.LookupPath("docs")
+	versions := fs.versionsLookup(dir, versionsName)
+	fileDir := fs.versionsLookup(versions, "a.txt")
+	if fileDir == nil {
+		t.Fatal("no versions dir for a.txt")
+	}
+	names := func() map[string]bool {
+		fs.versionsList(fileDir)
+		ret := map[string]bool{}
+		for _, e := range fs.Root.ListByParent(fileDir) {
+			ret[e.Name] = true
+		}
+		return ret
+	}
+	want := []string{"2020-01-02T03:04:05_r1", "2020-01-02T04:04:05_r2"}
+	for i := 0; i < 3; i++ {
+		if got := names(); len(got) != 2 || !got[want[0]] || !got[want[1]] {
+			t.Fatalf("revisions = %v", got)
+		}
+	}
+	if fs.versionsLookup(fileDir, want[0]) == nil {
+		t.Error("revision lookup failed")
+	}
+	if s.calls["Revisions"] != 1 {
+		t.Errorf("Revisions called %d times within refresh interval", s.calls["Revisions"])
+	}
+
+	// Loaded again after the interval, removed revisions are dropped
+	s.revisions["f"] = s.revisions["f"][1:]
+	fs.Config.SetRefresh(0)
+	if got := names(); len(got) != 1 || !got[want[1]] {
+		t.Errorf("revisions after reload = %v", got)
+	}
+	if fs.versionsLookup(fileDir, want[0]) != nil {
+		t.Error("removed revision still found")
+	}
+}
@@ -0,0 +1,48 @@
+package dropboxfs
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gohxs/cloudmount/internal/coreutil"
+	"github.com/gohxs/cloudmount/internal/oauth2util"
+	"golang.org/x/oauth2"
+)
+
+func oauthConfig(serviceConfig *Config) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     serviceConfig.ClientSecret.ClientID,
+		ClientSecret: serviceConfig.ClientSecret.ClientSecret,
+		RedirectURL:  "",
+		Scopes:       []string{},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  "https://www.dropbox.com/oauth2/authorize",
+			TokenURL: "https://api.dropboxapi.com/oauth2/token",
+		},
+	}
+}
+
+// tokenTransport authorizes requests with the config token, refreshed
+// tokens are saved in source
+func tokenTransport(source string, serviceConfig *Config) http.RoundTripper {
+	save := func(tok *oauth2.Token) error {
+		serviceConfig.Auth = tok
+		return coreutil.SaveConfig(source, serviceConfig)
+	}
+	reauth := fmt.Sprintf("remove 'auth' from %s and mount again", source)
+	ts := oauth2util.PersistentTokenSource(oauthConfig(serviceConfig), serviceConfig.Auth, save, reauth)
+	return oauth2.NewClient(oauth2.NoContext, ts).Transport
+}
+
+// Reload reloads credentials from source (i.e: rotated app secret)
+func (s *Service) Reload() error {
+	serviceConfig := Config{}
+	if err := coreutil.ParseConfig(s.source, &serviceConfig); err != nil {
+		return err
+	}
+	if serviceConfig.Auth == nil {
+		return fmt.Errorf("no 'auth' in %s, mount again to authorize", s.source)
+	}
+	s.transport.Set(tokenTransport(s.source, &serviceConfig))
+	return nil
+}
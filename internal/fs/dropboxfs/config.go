@@ -1,6 +1,9 @@
 package dropboxfs
 
-import "golang.org/x/oauth2"
+import (
+	"github.com/gohxs/cloudmount/internal/coreutil"
+	"golang.org/x/oauth2"
+)
 
 //Config Configuration
 type Config struct {
@@ -8,8 +11,20 @@ type Config struct {
 		ClientID     string `json:"client_id" yaml:"client_id"`
 		ClientSecret string `json:"client_secret" yaml:"client_secret"`
 	} `json:"client_secret" yaml:"client_secret"`
-	Auth    *oauth2.Token `json:"auth" yaml:"auth"`
-	Options struct {
-		Safemode bool
+	Type         string        `json:"type,omitempty" yaml:"type,omitempty"`                   // Read by core, kept on save
+	Root         string        `json:"root,omitempty" yaml:"root,omitempty"`                   // Read by core, kept on save
+	MountOptions string        `json:"mount_options,omitempty" yaml:"mount_options,omitempty"` // Read by core, kept on save
+	Auth         *oauth2.Token `json:"auth" yaml:"auth"`
+	Options      interface{}   `json:"options,omitempty" yaml:"options,omitempty"` // Ignored, safemode of older configs
+}
+
+// Validate checks required credentials
+func (c *Config) Validate() error {
+	if c.ClientSecret.ClientID == "" {
+		return &coreutil.FieldError{Field: "client_secret.client_id", Msg: "required"}
+	}
+	if c.ClientSecret.ClientSecret == "" {
+		return &coreutil.FieldError{Field: "client_secret.client_secret", Msg: "required"}
 	}
+	return nil
 }
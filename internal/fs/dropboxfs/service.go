@@ -2,7 +2,9 @@ package dropboxfs
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -22,11 +24,18 @@ import (
 // Service basefs Service implementation
 type Service struct {
 	dbconfig    dropbox.Config
+	transport   *coreutil.SwitchTransport // Credentials, replaced on reload
+	source      string
 	savedCursor string
+	root        string // Mount root lower path, empty for the whole account
 }
 
 // Assure implementation
-var _ basefs.Service = &Service{}
+var (
+	_ basefs.Service         = &Service{}
+	_ basefs.RevisionService = &Service{}
+	_ basefs.ReloadService   = &Service{}
+)
 
 //NewService creates Dropbox service
 func NewService(coreConfig *core.Config) *Service {
@@ -39,25 +48,65 @@ func NewService(coreConfig *core.Config) *Service {
 	if err != nil {
 		errlog.Fatalf("Unable to read <source>: %v", err)
 	}
-	config := &oauth2.Config{
-		ClientID:     serviceConfig.ClientSecret.ClientID,
-		ClientSecret: serviceConfig.ClientSecret.ClientSecret,
-		RedirectURL:  "",
-		Scopes:       []string{},
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  "https://www.dropbox.com/1/oauth2/authorize",
-			TokenURL: "https://api.dropbox.com/1/oauth2/token",
-		},
-	}
 	if serviceConfig.Auth == nil {
-		tok := oauth2util.GetTokenFromWeb(config)
+		// Access tokens are short lived, request a refresh token
+		tok := oauth2util.GetTokenFromWeb(oauthConfig(&serviceConfig), oauth2.SetAuthURLParam("token_access_type", "offline"))
 		serviceConfig.Auth = tok
-		coreutil.SaveConfig(coreConfig.Source, &serviceConfig)
+		if err := coreutil.SaveConfig(coreConfig.Source, &serviceConfig); err != nil {
+			errlog.Println("Unable to save token:", err)
+		}
 	}
 
-	dbconfig := dropbox.Config{Token: serviceConfig.Auth.AccessToken}
+	transport := &coreutil.SwitchTransport{}
+	transport.Set(tokenTransport(coreConfig.Source, &serviceConfig))
+	// Refreshing client used by every dbfiles.New(s.dbconfig)
+	dbconfig := dropbox.Config{Client: &http.Client{Transport: coreutil.LimitTransport(transport)}}
 
-	return &Service{dbconfig: dbconfig}
+	s := &Service{dbconfig: dbconfig, transport: transport, source: coreConfig.Source}
+	if coreConfig.Options.Root != "" {
+		s.root, err = s.resolveRoot(coreConfig.Options.Root)
+		if err != nil {
+			errlog.Fatalf("Unable to resolve root '%s': %v", coreConfig.Options.Root, err)
+		}
+		log.Println("Mounting folder:", s.root)
+	}
+
+	return s
+}
+
+// resolveRoot resolves a folder path or id into a lower path
+func (s *Service) resolveRoot(root string) (string, error) {
+	fileService := dbfiles.New(s.dbconfig)
+
+	if !strings.HasPrefix(root, "/") && !strings.HasPrefix(root, "id:") {
+		root = "/" + root
+	}
+	md, err := fileService.GetMetadata(dbfiles.NewGetMetadataArg(strings.TrimSuffix(root, "/")))
+	if err != nil {
+		return "", err
+	}
+	folder, ok := md.(*dbfiles.FolderMetadata)
+	if !ok {
+		return "", fmt.Errorf("'%s' is not a folder", root)
+	}
+	return folder.PathLower, nil
+}
+
+// parentID returns the dropbox parent path, nil parent is the mount root
+func (s *Service) parentID(parent *basefs.File) string {
+	if parent == nil {
+		return s.root
+	}
+	return parent.ID
+}
+
+// file converts dropbox metadata, files in mount root have no parents
+func (s *Service) file(metadata dbfiles.IsMetadata) *basefs.File {
+	file := File(metadata)
+	if s.root != "" && len(file.Parents) > 0 && file.Parents[0] == s.root {
+		file.Parents = []string{}
+	}
+	return file
 
 }
 
@@ -70,7 +119,7 @@ func (s *Service) Changes() ([]*basefs.Change, error) {
 	}
 
 	if s.savedCursor == "" {
-		res, err := fileService.ListFolderGetLatestCursor(&dbfiles.ListFolderArg{Path: "", Recursive: true})
+		res, err := fileService.ListFolderGetLatestCursor(&dbfiles.ListFolderArg{Path: s.root, Recursive: true})
 		if err != nil {
 			log.Println("Err:", err)
 			return nil, err
@@ -98,11 +147,14 @@ func (s *Service) Changes() ([]*basefs.Change, error) {
 			var change *basefs.Change
 			switch t := e.(type) {
 			case *dbfiles.DeletedMetadata:
-				change = &basefs.Change{ID: t.PathLower, File: File(t), Remove: true}
+				change = &basefs.Change{ID: t.PathLower, File: s.file(t), Remove: true}
 			case *dbfiles.FileMetadata:
-				change = &basefs.Change{ID: t.PathLower, File: File(t), Remove: false}
+				change = &basefs.Change{ID: t.PathLower, File: s.file(t), Remove: false}
 			case *dbfiles.FolderMetadata:
-				change = &basefs.Change{ID: t.PathLower, File: File(t), Remove: false}
+				if t.PathLower == s.root { // Mount root itself
+					continue
+				}
+				change = &basefs.Change{ID: t.PathLower, File: s.file(t), Remove: false}
 			}
 			ret = append(ret, change)
 
@@ -113,7 +165,7 @@ func (s *Service) Changes() ([]*basefs.Change, error) {
 	}
 	{
 		// Store new token
-		res, err := fileService.ListFolderGetLatestCursor(&dbfiles.ListFolderArg{Path: "", Recursive: true})
+		res, err := fileService.ListFolderGetLatestCursor(&dbfiles.ListFolderArg{Path: s.root, Recursive: true})
 		if err != nil {
 			log.Println("Err:", err)
 			return nil, err
@@ -133,22 +185,26 @@ func (s *Service) ListAll() ([]*basefs.File, error) {
 	var err error
 	var res *dbfiles.ListFolderResult
 
-	res, err = fileService.ListFolder(&dbfiles.ListFolderArg{Recursive: true, Path: "", IncludeDeleted: false, IncludeMediaInfo: false})
+	res, err = fileService.ListFolder(&dbfiles.ListFolderArg{Recursive: true, Path: s.root, IncludeDeleted: false, IncludeMediaInfo: false})
 	if err != nil {
 		log.Println("Error listing:", err)
 		return nil, err
 	}
-	log.Println("Loaded: res.Entries", len(res.Entries))
-	for _, e := range res.Entries {
-		ret = append(ret, File(e))
-	}
-
-	for res.HasMore {
-		res, _ = fileService.ListFolderContinue(&dbfiles.ListFolderContinueArg{Cursor: res.Cursor})
-		// Ignoring error?
+	for {
 		log.Println("Loaded: res.Entries", len(res.Entries))
 		for _, e := range res.Entries {
-			ret = append(ret, File(e))
+			if f, ok := e.(*dbfiles.FolderMetadata); ok && f.PathLower == s.root { // Mount root itself
+				continue
+			}
+			ret = append(ret, s.file(e))
+		}
+		if !res.HasMore {
+			break
+		}
+		res, err = fileService.ListFolderContinue(&dbfiles.ListFolderContinueArg{Cursor: res.Cursor})
+		if err != nil {
+			log.Println("Error listing:", err)
+			return nil, err
 		}
 	}
 
@@ -159,10 +215,7 @@ func (s *Service) ListAll() ([]*basefs.File, error) {
 func (s *Service) Create(parent *basefs.File, name string, isDir bool) (*basefs.File, error) {
 	fileService := dbfiles.New(s.dbconfig)
 
-	parentID := ""
-	if parent != nil {
-		parentID = parent.ID
-	}
+	parentID := s.parentID(parent)
 	if isDir {
 		data, err := fileService.CreateFolder(&dbfiles.CreateFolderArg{
 			Autorename: false,
@@ -171,7 +224,7 @@ func (s *Service) Create(parent *basefs.File, name string, isDir bool) (*basefs.
 		if err != nil {
 			return nil, err
 		}
-		return File(data), nil
+		return s.file(data), nil
 	}
 
 	newPath := parentID + "/" + name
@@ -186,7 +239,7 @@ func (s *Service) Create(parent *basefs.File, name string, isDir bool) (*basefs.
 		return nil, err
 	}
 
-	return File(data), nil
+	return s.file(data), nil
 
 }
 
@@ -205,7 +258,7 @@ func (s *Service) Upload(reader io.Reader, file *basefs.File) (*basefs.File, err
 		return nil, err
 	}
 
-	return File(data), nil
+	return s.file(data), nil
 }
 
 // DownloadTo implementation
@@ -218,19 +271,52 @@ func (s *Service) DownloadTo(w io.Writer, file *basefs.File) error {
 	}
 
 	defer content.Close()
-	io.Copy(w, content)
+	_, err = io.Copy(w, content)
 
-	return nil
+	return err
+}
+
+// Revisions lists file revisions
+func (s *Service) Revisions(file *basefs.File) ([]*basefs.File, error) {
+	fileService := dbfiles.New(s.dbconfig)
+
+	arg := dbfiles.NewListRevisionsArg(file.ID)
+	arg.Limit = 100 // Max allowed
+	res, err := fileService.ListRevisions(arg)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*basefs.File{}
+	for _, e := range res.Entries {
+		rev := File(e)
+		rev.ID = e.Rev
+		rev.Mode = os.FileMode(0444)
+		rev.Parents = nil
+		ret = append(ret, rev)
+	}
+	return ret, nil
+}
+
+// DownloadRevisionTo downloads a file revision to a writer
+func (s *Service) DownloadRevisionTo(w io.Writer, file *basefs.File, revision *basefs.File) error {
+	fileService := dbfiles.New(s.dbconfig)
+
+	_, content, err := fileService.Download(&dbfiles.DownloadArg{Path: "rev:" + revision.ID})
+	if err != nil {
+		return err
+	}
+
+	defer content.Close()
+	_, err = io.Copy(w, content)
+
+	return err
 }
 
 // Move and Rename file implementation
 func (s *Service) Move(file *basefs.File, newParent *basefs.File, name string) (*basefs.File, error) {
 	fileService := dbfiles.New(s.dbconfig)
 
-	newParentID := ""
-	if newParent != nil {
-		newParentID = newParent.ID
-	}
+	newParentID := s.parentID(newParent)
 
 	res, err := fileService.Move(&dbfiles.RelocationArg{
 		RelocationPath: dbfiles.RelocationPath{
@@ -242,7 +328,7 @@ func (s *Service) Move(file *basefs.File, newParent *basefs.File, name string) (
 		return nil, err
 	}
 
-	return File(res), nil
+	return s.file(res), nil
 }
 
 // Delete deletes a file entry (including Dir)
@@ -0,0 +1,105 @@
+package gdrivefs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gohxs/cloudmount/internal/coreutil"
+	"github.com/gohxs/cloudmount/internal/oauth2util"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	drive "google.golang.org/api/drive/v3"
+)
+
+// newClient builds the http client for the configured credentials
+func newClient(source string, serviceConfig *Config) (*http.Client, error) {
+	if serviceConfig.ServiceAccount != nil {
+		client, err := serviceAccountClient(source, serviceConfig.ServiceAccount)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load service account: %v", err)
+		}
+		return client, nil
+	}
+	return userClient(source, serviceConfig), nil
+}
+
+// Reload reloads credentials from source (i.e: rotated client secret or key)
+func (s *Service) Reload() error {
+	serviceConfig := Config{}
+	if err := coreutil.ParseConfig(s.source, &serviceConfig); err != nil {
+		return err
+	}
+	if serviceConfig.ServiceAccount == nil && serviceConfig.Auth == nil {
+		return fmt.Errorf("no 'auth' in %s, mount again to authorize", s.source)
+	}
+	client, err := newClient(s.source, &serviceConfig)
+	if err != nil {
+		return err
+	}
+	s.transport.Set(client.Transport)
+	return nil
+}
+
+// userClient builds an http client from the user oauth2 token, requesting
+// a new token if there is none, refreshed tokens are saved in source
+func userClient(source string, serviceConfig *Config) *http.Client {
+	config := &oauth2.Config{
+		ClientID:     serviceConfig.ClientSecret.ClientID,
+		ClientSecret: serviceConfig.ClientSecret.ClientSecret,
+		RedirectURL:  "http://127.0.0.1", // Loopback, any port
+		Scopes:       []string{drive.DriveScope},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:       "https://accounts.google.com/o/oauth2/auth",  //d.serviceConfig.ClientSecret.AuthURI,
+			TokenURL:      "https://accounts.google.com/o/oauth2/token", //d.serviceConfig.ClientSecret.TokenURI,
+			DeviceAuthURL: "https://oauth2.googleapis.com/device/code",
+		},
+	}
+	if serviceConfig.Auth == nil {
+		tok := oauth2util.GetTokenFromWeb(config)
+		serviceConfig.Auth = tok
+		if err := coreutil.SaveConfig(source, serviceConfig); err != nil {
+			errlog.Println("Unable to save token:", err)
+		}
+	}
+
+	save := func(tok *oauth2.Token) error {
+		serviceConfig.Auth = tok
+		return coreutil.SaveConfig(source, serviceConfig)
+	}
+	reauth := fmt.Sprintf("remove 'auth' from %s and mount again", source)
+	ts := oauth2util.PersistentTokenSource(config, serviceConfig.Auth, save, reauth)
+	return oauth2.NewClient(oauth2.NoContext, ts)
+}
+
+// ServiceAccount authenticates without user interaction (i.e: headless
+// servers), Subject impersonates a domain user with domain-wide delegation
+//   service_account:
+//     key_file: key.json # relative to source config
+//     subject: user@example.com
+type ServiceAccount struct {
+	KeyFile string `json:"key_file" yaml:"key_file"`
+	Subject string `json:"subject,omitempty" yaml:"subject,omitempty"`
+}
+
+// serviceAccountClient builds an http client from a service account key
+func serviceAccountClient(source string, sa *ServiceAccount) (*http.Client, error) {
+	keyFile := sa.KeyFile
+	if !filepath.IsAbs(keyFile) {
+		keyFile = filepath.Join(filepath.Dir(source), keyFile)
+	}
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	jwtConfig, err := google.JWTConfigFromJSON(data, drive.DriveScope)
+	if err != nil {
+		return nil, err
+	}
+	jwtConfig.Subject = sa.Subject
+	return jwtConfig.Client(context.Background()), nil
+}
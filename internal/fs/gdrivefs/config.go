@@ -1,6 +1,9 @@
 package gdrivefs
 
-import "golang.org/x/oauth2"
+import (
+	"github.com/gohxs/cloudmount/internal/coreutil"
+	"golang.org/x/oauth2"
+)
 
 //Config  gdrive.yaml config file structure
 type Config struct {
@@ -9,9 +12,50 @@ type Config struct {
 		ClientSecret string `json:"client_secret" yaml:"client_secret"`
 	} `json:"client_secret" yaml:"client_secret"`
 
-	Auth    *oauth2.Token     `json:"auth" yaml:"auth"`
-	Mime    map[string]string `json:"mime" yaml:"mime"`
-	Options struct {
-		Safemode bool
+	Type           string            `json:"type,omitempty" yaml:"type,omitempty"`                   // Read by core, kept on save
+	Root           string            `json:"root,omitempty" yaml:"root,omitempty"`                   // Read by core, kept on save
+	MountOptions   string            `json:"mount_options,omitempty" yaml:"mount_options,omitempty"` // Read by core, kept on save
+	ServiceAccount *ServiceAccount   `json:"service_account,omitempty" yaml:"service_account,omitempty"`
+	Auth           *oauth2.Token     `json:"auth" yaml:"auth"`
+	Mime           map[string]string `json:"mime" yaml:"mime"`                               // Export format by workspace mime type
+	Links          string            `json:"links" yaml:"links"`                             // Link files type: desktop, url
+	Shortcuts      string            `json:"shortcuts,omitempty" yaml:"shortcuts,omitempty"` // Shortcuts as: symlink, alias
+	Convert        []string          `json:"convert,omitempty" yaml:"convert,omitempty"`     // Folders where uploads are converted to workspace files
+	Options        interface{}       `json:"options,omitempty" yaml:"options,omitempty"`     // Ignored, safemode of older configs
+}
+
+// Validate checks required credentials and option values
+func (c *Config) Validate() error {
+	if c.ServiceAccount != nil {
+		if c.ServiceAccount.KeyFile == "" {
+			return &coreutil.FieldError{Field: "service_account.key_file", Msg: "required"}
+		}
+		return c.validateOptions()
+	}
+	if c.ClientSecret.ClientID == "" {
+		return &coreutil.FieldError{Field: "client_secret.client_id", Msg: "required (or service_account)"}
+	}
+	if c.ClientSecret.ClientSecret == "" {
+		return &coreutil.FieldError{Field: "client_secret.client_secret", Msg: "required (or service_account)"}
+	}
+	return c.validateOptions()
+}
+
+func (c *Config) validateOptions() error {
+	switch c.Links {
+	case "", "desktop", "url":
+	default:
+		return &coreutil.FieldError{Field: "links", Msg: "must be desktop or url"}
+	}
+	switch c.Shortcuts {
+	case "", shortcutsSymlink, shortcutsAlias:
+	default:
+		return &coreutil.FieldError{Field: "shortcuts", Msg: "must be symlink or alias"}
+	}
+	for mime, format := range c.Mime {
+		if format == "" {
+			return &coreutil.FieldError{Field: "mime." + mime, Msg: "empty export format"}
+		}
 	}
+	return nil
 }
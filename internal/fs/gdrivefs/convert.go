@@ -0,0 +1,162 @@
+package gdrivefs
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gohxs/cloudmount/internal/fs/basefs"
+
+	drive "google.golang.org/api/drive/v3"
+)
+
+// Uploads can be converted into workspace files (as drive web uploader does)
+// in folders listed in source config, sub folders included:
+//   convert:
+//     - /             # everywhere
+//     - Team/Reports
+// Converted files keep the uploaded extension as export format while mounted
+
+// Workspace type by uploaded extension
+var importFormats = map[string]string{
+	"docx": docMime,
+	"doc":  docMime,
+	"odt":  docMime,
+	"rtf":  docMime,
+	"xlsx": sheetMime,
+	"xls":  sheetMime,
+	"ods":  sheetMime,
+	"csv":  sheetMime,
+	"tsv":  sheetMime,
+	"pptx": slidesMime,
+	"ppt":  slidesMime,
+	"odp":  slidesMime,
+}
+
+// Legacy office formats, importable but drive can't export them, converted
+// files keep the created name and are exported as the current office format
+var legacyFormats = map[string]exportFormat{
+	"doc": {Mime: exportFormats["docx"].Mime, Ext: "doc", Import: "application/msword"},
+	"xls": {Mime: exportFormats["xlsx"].Mime, Ext: "xls", Import: "application/vnd.ms-excel"},
+	"ppt": {Mime: exportFormats["pptx"].Mime, Ext: "ppt", Import: "application/vnd.ms-powerpoint"},
+}
+
+// imports keeps the uploaded format of converted files
+type imports struct {
+	sync.Mutex
+	all     bool                // Convert everywhere
+	folders map[string]bool     // Convert in these folders
+	parents map[string][]string // Drive parents of listed folders
+	formats map[string]exportFormat
+}
+
+// resolveConvert resolves configured convert folders, converts everywhere if
+// the mount root is inside one
+func (s *Service) resolveConvert() error {
+	s.imports.folders = map[string]bool{}
+	s.imports.parents = map[string][]string{}
+	s.imports.formats = map[string]exportFormat{}
+	for _, p := range s.serviceConfig.Convert {
+		if strings.Trim(p, "/") == "" {
+			s.imports.all = true
+			continue
+		}
+		id, err := s.resolveRoot(p)
+		if err != nil {
+			return err
+		}
+		s.imports.folders[id] = true
+	}
+	if s.imports.all || len(s.imports.folders) == 0 {
+		return nil
+	}
+	// Mount root ancestors are not listed, walk them once
+	id := s.rootID
+	for depth := 0; id != "" && depth < 64; depth++ {
+		if s.imports.folders[id] {
+			s.imports.all = true
+			return nil
+		}
+		gfile, err := s.client.Files.Get(id).SupportsAllDrives(true).Fields("parents").Do()
+		if err != nil {
+			return err
+		}
+		if len(gfile.Parents) == 0 {
+			break
+		}
+		id = gfile.Parents[0]
+	}
+	return nil
+}
+
+// importFormat returns the workspace type and uploaded format if a file named
+// name created in parent should be converted
+func (s *Service) importFormat(parent *basefs.File, name string) (string, *exportFormat) {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	target, ok := importFormats[ext]
+	if !ok || !s.convertIn(parent) {
+		return "", nil
+	}
+	f, ok := legacyFormats[ext]
+	if !ok {
+		f = exportFormats[ext]
+	}
+	return target, &f
+}
+
+// convertIn checks if parent is in a convert folder, walking up the parents
+// of listed folders
+func (s *Service) convertIn(parent *basefs.File) bool {
+	if s.imports.all {
+		return true
+	}
+	if len(s.imports.folders) == 0 {
+		return false
+	}
+	s.imports.Lock()
+	defer s.imports.Unlock()
+	visited := map[string]bool{}
+	pending := []string{s.parentID(parent)}
+	for len(pending) > 0 {
+		id := pending[0]
+		pending = pending[1:]
+		if s.imports.folders[id] {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		pending = append(pending, s.imports.parents[id]...)
+	}
+	return false
+}
+
+// trackFolder records the drive parents of a listed folder for convertIn
+func (s *Service) trackFolder(gfile *drive.File) {
+	if gfile.MimeType != folderMime || len(s.imports.folders) == 0 {
+		return
+	}
+	s.imports.Lock()
+	defer s.imports.Unlock()
+	s.imports.parents[gfile.Id] = gfile.Parents
+}
+
+// setImport records the uploaded format of a converted file
+func (s *Service) setImport(id string, f *exportFormat) {
+	s.imports.Lock()
+	defer s.imports.Unlock()
+	s.imports.formats[id] = *f
+}
+
+// fileExport returns the export format of gfile, the uploaded format for
+// files converted while mounted
+func (s *Service) fileExport(gfile *drive.File) *exportFormat {
+	s.imports.Lock()
+	f, ok := s.imports.formats[gfile.Id]
+	s.imports.Unlock()
+	if ok && strings.HasPrefix(gfile.MimeType, workspacePrefix) {
+		return &f
+	}
+	return s.exportFormat(gfile.MimeType)
+}
@@ -0,0 +1,150 @@
+package gdrivefs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	drive "google.golang.org/api/drive/v3"
+)
+
+// Google workspace files can't be downloaded directly, they are exported to a
+// format configured by mime type in source config:
+//   mime:
+//     application/vnd.google-apps.document: pdf # extension or mime type
+//     application/vnd.google-apps.form: link
+// files that can't be exported are shown as link files
+const (
+	workspacePrefix = "application/vnd.google-apps."
+	docMime         = workspacePrefix + "document"
+	sheetMime       = workspacePrefix + "spreadsheet"
+	slidesMime      = workspacePrefix + "presentation"
+	drawingMime     = workspacePrefix + "drawing"
+	scriptMime      = workspacePrefix + "script"
+	jamMime         = workspacePrefix + "jam"
+
+	// Config value to force link files
+	linkFormat = "link"
+)
+
+// exportFormat target format of a workspace file
+type exportFormat struct {
+	Mime   string
+	Ext    string
+	Link   bool   // Not exportable, shown as link file
+	Import string // Uploaded mime if not Mime (legacy formats)
+}
+
+// Known export formats by extension
+var exportFormats = map[string]exportFormat{
+	"docx": {Mime: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", Ext: "docx"},
+	"odt":  {Mime: "application/vnd.oasis.opendocument.text", Ext: "odt"},
+	"rtf":  {Mime: "application/rtf", Ext: "rtf"},
+	"txt":  {Mime: "text/plain", Ext: "txt"},
+	"html": {Mime: "text/html", Ext: "html"},
+	"epub": {Mime: "application/epub+zip", Ext: "epub"},
+	"md":   {Mime: "text/markdown", Ext: "md"},
+	"pdf":  {Mime: "application/pdf", Ext: "pdf"},
+	"xlsx": {Mime: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Ext: "xlsx"},
+	"ods":  {Mime: "application/vnd.oasis.opendocument.spreadsheet", Ext: "ods"},
+	"csv":  {Mime: "text/csv", Ext: "csv"},
+	"tsv":  {Mime: "text/tab-separated-values", Ext: "tsv"},
+	"pptx": {Mime: "application/vnd.openxmlformats-officedocument.presentationml.presentation", Ext: "pptx"},
+	"odp":  {Mime: "application/vnd.oasis.opendocument.presentation", Ext: "odp"},
+	"png":  {Mime: "image/png", Ext: "png"},
+	"jpg":  {Mime: "image/jpeg", Ext: "jpg"},
+	"svg":  {Mime: "image/svg+xml", Ext: "svg"},
+	"json": {Mime: "application/vnd.google-apps.script+json", Ext: "json"},
+}
+
+// Default export extension by workspace mime type, others are link files
+var defaultExports = map[string]string{
+	docMime:     "docx",
+	sheetMime:   "xlsx",
+	slidesMime:  "pptx",
+	drawingMime: "png",
+	scriptMime:  "json",
+	jamMime:     "pdf",
+}
+
+// exportFormat returns the export format for a mime type, nil if the file
+// can be downloaded as is
+func (s *Service) exportFormat(mimeType string) *exportFormat {
+	if !strings.HasPrefix(mimeType, workspacePrefix) || mimeType == folderMime || mimeType == shortcutMime {
+		return nil
+	}
+	value, ok := s.serviceConfig.Mime[mimeType]
+	if !ok {
+		value = defaultExports[mimeType]
+	}
+	value = strings.TrimPrefix(value, ".")
+	if f, ok := exportFormats[value]; ok {
+		return &f
+	}
+	if value == "" || value == linkFormat {
+		return &exportFormat{Link: true, Ext: s.linkExt()}
+	}
+	// Mime type, try to find a known extension
+	for _, f := range exportFormats {
+		if f.Mime == value {
+			return &f
+		}
+	}
+	return &exportFormat{Mime: value, Ext: strings.Replace(value[strings.LastIndex(value, "/")+1:], "+", ".", -1)}
+}
+
+// cloudName removes the export extension from a local name
+func (s *Service) cloudName(gfile *drive.File, name string) string {
+	if f := s.fileExport(s.content(gfile)); f != nil {
+		return strings.TrimSuffix(name, "."+f.Ext)
+	}
+	return name
+}
+
+// linkExt link file extension from config (desktop or url)
+func (s *Service) linkExt() string {
+	if s.serviceConfig.Links == "url" {
+		return "url"
+	}
+	return "desktop"
+}
+
+// linkContent link file pointing to the workspace file
+func (s *Service) linkContent(gfile *drive.File) []byte {
+	url := "https://drive.google.com/open?id=" + gfile.Id
+	if s.linkExt() == "url" {
+		return []byte(fmt.Sprintf("[InternetShortcut]\r\nURL=%s\r\n", url))
+	}
+	return []byte(fmt.Sprintf("[Desktop Entry]\nType=Link\nName=%s\nURL=%s\nIcon=text-html\n", gfile.Name, url))
+}
+
+// exportSizes sizes of exported files, known after the first export
+type exportSizes struct {
+	sync.Mutex
+	sizes map[string]exportSize
+}
+
+type exportSize struct {
+	modifiedTime string
+	size         uint64
+}
+
+func (es *exportSizes) set(gfile *drive.File, size uint64) {
+	es.Lock()
+	defer es.Unlock()
+	if es.sizes == nil {
+		es.sizes = map[string]exportSize{}
+	}
+	es.sizes[gfile.Id] = exportSize{gfile.ModifiedTime, size}
+}
+
+// get returns the export size if the file was not modified since
+func (es *exportSizes) get(gfile *drive.File) (uint64, bool) {
+	es.Lock()
+	defer es.Unlock()
+	s, ok := es.sizes[gfile.Id]
+	if !ok || s.modifiedTime != gfile.ModifiedTime {
+		return 0, false
+	}
+	return s.size, true
+}
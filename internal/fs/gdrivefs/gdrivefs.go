@@ -2,23 +2,20 @@ package gdrivefs
 
 import (
 	"github.com/gohxs/cloudmount/internal/core"
+	"github.com/gohxs/cloudmount/internal/coreutil"
 	"github.com/gohxs/cloudmount/internal/fs/basefs"
 	"github.com/gohxs/prettylog"
 )
 
 var (
 	pname  = "gdrive"
-	log    = prettylog.Dummy()
+	log    = coreutil.VerboseLogger(pname, 1)
 	errlog = prettylog.New(pname + "-err")
 )
 
 // New new Filesystem implementation based on gdrive Service
 func New(core *core.Core) core.DriverFS {
 
-	if core.Config.VerboseLog {
-		log = prettylog.New(pname)
-	}
-
 	fs := basefs.New(core)
 	fs.Service = NewService(&core.Config)
 
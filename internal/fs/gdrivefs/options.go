@@ -0,0 +1,44 @@
+package gdrivefs
+
+// Options gdrive mount options (-o gdrive.<name>=value), override source config
+type Options struct {
+	ExportDocs     string   `opt:"export_docs" desc:"Docs export format, extension or mime type"`
+	ExportSheets   string   `opt:"export_sheets" desc:"Sheets export format"`
+	ExportSlides   string   `opt:"export_slides" desc:"Slides export format"`
+	ExportDrawings string   `opt:"export_drawings" desc:"Drawings export format"`
+	Links          string   `opt:"links" enum:"desktop,url" desc:"Link files type"`
+	Shortcuts      string   `opt:"shortcuts" enum:"symlink,alias" desc:"Shortcuts shown as"`
+	Convert        []string `opt:"convert" desc:"Folders where uploads are converted to Google formats"`
+}
+
+// apply returns a copy of source config with options set, the copy is never
+// saved so options given on mount don't end up in source
+func (o *Options) apply(src Config) Config {
+	c := src
+	c.Mime = map[string]string{}
+	for mime, format := range src.Mime {
+		c.Mime[mime] = format
+	}
+	exports := map[string]string{
+		docMime:     o.ExportDocs,
+		sheetMime:   o.ExportSheets,
+		slidesMime:  o.ExportSlides,
+		drawingMime: o.ExportDrawings,
+	}
+	for mime, format := range exports {
+		if format == "" {
+			continue
+		}
+		c.Mime[mime] = format
+	}
+	if o.Links != "" {
+		c.Links = o.Links
+	}
+	if o.Shortcuts != "" {
+		c.Shortcuts = o.Shortcuts
+	}
+	if len(o.Convert) > 0 {
+		c.Convert = o.Convert
+	}
+	return c
+}
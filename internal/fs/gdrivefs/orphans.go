@@ -0,0 +1,99 @@
+package gdrivefs
+
+import (
+	"github.com/gohxs/cloudmount/internal/fs/basefs"
+
+	drive "google.golang.org/api/drive/v3"
+)
+
+// Files whose parents are not visible (i.e: shared with us) are placed in a
+// virtual folder in mount root, and moved to the real parent once it shows up
+const (
+	orphansID   = "cloudmount:orphans"
+	orphansName = ".orphans"
+)
+
+// resetOrphans clears known folders and orphans before a full listing
+func (s *Service) resetOrphans() {
+	s.orphansMU.Lock()
+	defer s.orphansMU.Unlock()
+	s.folders = map[string]bool{}
+	s.orphans = map[string]*drive.File{}
+	s.orphansDir = false
+}
+
+// addFolder registers a folder visible in the mount
+func (s *Service) addFolder(id string) {
+	s.orphansMU.Lock()
+	defer s.orphansMU.Unlock()
+	s.folders[id] = true
+}
+
+// parentsVisible checks if any of gfile parents is visible in the mount
+func (s *Service) parentsVisible(gfile *drive.File) bool {
+	s.orphansMU.Lock()
+	defer s.orphansMU.Unlock()
+	for _, pID := range gfile.Parents {
+		if pID == s.rootID || s.folders[pID] {
+			return true
+		}
+	}
+	return false
+}
+
+// orphanFile converts an orphan gfile placing it in the orphans folder
+func (s *Service) orphanFile(gfile *drive.File) *basefs.File {
+	s.orphansMU.Lock()
+	s.orphans[gfile.Id] = gfile
+	s.orphansMU.Unlock()
+
+	file := s.file(gfile)
+	file.Parents = []string{orphansID}
+	return file
+}
+
+// forgetOrphan removes id from orphans
+func (s *Service) forgetOrphan(id string) {
+	s.orphansMU.Lock()
+	defer s.orphansMU.Unlock()
+	delete(s.orphans, id)
+}
+
+// orphansDirChange returns a change adding the orphans folder if not added yet
+func (s *Service) orphansDirChange() *basefs.Change {
+	s.orphansMU.Lock()
+	defer s.orphansMU.Unlock()
+	if s.orphansDir {
+		return nil
+	}
+	s.orphansDir = true
+	return &basefs.Change{ID: orphansID, File: s.file(orphansDirFile())}
+}
+
+// adopt moves orphans whose parent is the newly visible folderID
+func (s *Service) adopt(folderID string) []*basefs.Change {
+	s.orphansMU.Lock()
+	defer s.orphansMU.Unlock()
+
+	ret := []*basefs.Change{}
+	for id, gfile := range s.orphans {
+		for _, pID := range gfile.Parents {
+			if pID != folderID {
+				continue
+			}
+			log.Println("Orphan found parent:", gfile.Name)
+			delete(s.orphans, id)
+			ret = append(ret, &basefs.Change{ID: id, File: s.file(gfile)})
+			break
+		}
+	}
+	return ret
+}
+
+func orphansDirFile() *drive.File {
+	return &drive.File{
+		Id:       orphansID,
+		Name:     orphansName,
+		MimeType: folderMime,
+	}
+}
@@ -0,0 +1,189 @@
+package gdrivefs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gohxs/cloudmount/internal/fs/basefs"
+
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const folderMime = "application/vnd.google-apps.folder"
+
+// Max parents per query when listing a sub tree
+const listBatch = 50
+
+// resolveRoot resolves a folder path or ID into a drive folder ID
+func (s *Service) resolveRoot(root string) (string, error) {
+	if !strings.Contains(root, "/") {
+		gfile, err := s.client.Files.Get(root).SupportsAllDrives(true).Fields("id,mimeType").Do()
+		if err == nil && gfile.MimeType == folderMime {
+			return gfile.Id, nil
+		}
+		// Might be a folder name instead of ID
+	}
+
+	parentID := "root"
+	for _, name := range strings.Split(root, "/") {
+		if name == "" {
+			continue
+		}
+		q := fmt.Sprintf("'%s' in parents and name = '%s' and mimeType = '%s' and trashed = false",
+			parentID, queryEscape(name), folderMime)
+		r, err := s.client.Files.List().Q(q).Fields("files(id)").Do()
+		if err != nil {
+			return "", err
+		}
+		if len(r.Files) == 0 {
+			return "", fmt.Errorf("root folder '%s' not found in '%s'", name, root)
+		}
+		parentID = r.Files[0].Id
+	}
+	return parentID, nil
+}
+
+// listTree lists all files under folder rootID, folders are registered in scope
+func (s *Service) listTree(rootID string) ([]*drive.File, error) {
+	fileList := []*drive.File{}
+	pending := []string{rootID}
+	for len(pending) > 0 {
+		n := len(pending)
+		if n > listBatch {
+			n = listBatch
+		}
+		conds := []string{}
+		for _, id := range pending[:n] {
+			conds = append(conds, fmt.Sprintf("'%s' in parents", id))
+		}
+		pending = pending[n:]
+
+		q := "trashed = false and (" + strings.Join(conds, " or ") + ")"
+		pageToken := ""
+		for {
+			r, err := s.client.Files.List().
+				Q(q).
+				Corpora("allDrives").
+				SupportsAllDrives(true).
+				IncludeItemsFromAllDrives(true).
+				PageSize(1000).
+				PageToken(pageToken).
+				Fields(googleapi.Field("nextPageToken"), gdFields).
+				Do()
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range r.Files {
+				fileList = append(fileList, f)
+				if f.MimeType == folderMime {
+					s.setScope(f.Id)
+					pending = append(pending, f.Id)
+				}
+			}
+			if r.NextPageToken == "" {
+				break
+			}
+			pageToken = r.NextPageToken
+		}
+	}
+	return fileList, nil
+}
+
+// setScope registers a folder inside the mounted sub tree, returns false if
+// it was already registered
+func (s *Service) setScope(id string) bool {
+	s.scopeMU.Lock()
+	defer s.scopeMU.Unlock()
+	if s.scope[id] {
+		return false
+	}
+	s.scope[id] = true
+	return true
+}
+
+// unsetScope removes a folder moved out of the mounted sub tree
+func (s *Service) unsetScope(id string) {
+	s.scopeMU.Lock()
+	defer s.scopeMU.Unlock()
+	if id != s.rootID {
+		delete(s.scope, id)
+	}
+}
+
+// inScope checks if any of the parents is inside the mounted sub tree,
+// always true if mounting the whole drive
+func (s *Service) inScope(parents []string) bool {
+	s.scopeMU.Lock()
+	defer s.scopeMU.Unlock()
+	if s.scope == nil {
+		return true
+	}
+	for _, p := range parents {
+		if s.scope[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// isVirtualFolder checks if file is a virtual folder or a shared drive,
+// these can't be moved or deleted
+func (s *Service) isVirtualFolder(file *basefs.File) bool {
+	if file == nil {
+		return false
+	}
+	s.sharedDrivesMU.Lock()
+	defer s.sharedDrivesMU.Unlock()
+	return isVirtualParent(file) || s.sharedDrives[file.ID]
+}
+
+// isVirtualParent checks if parent is a virtual folder, files can't be placed on it
+func isVirtualParent(parent *basefs.File) bool {
+	return parent != nil && (parent.ID == sharedDrivesID || parent.ID == orphansID)
+}
+
+// parentID returns the drive parent ID, nil parent is the mount root
+func (s *Service) parentID(parent *basefs.File) string {
+	if parent == nil {
+		return s.rootID
+	}
+	return parent.ID
+}
+
+// file converts a google drive file, files in mount root have no parents,
+// workspace files are named with the export extension and shortcuts resolved
+func (s *Service) file(gfile *drive.File) *basefs.File {
+	file := File(gfile)
+	if file == nil {
+		return file
+	}
+	s.trackFolder(gfile)
+	content := s.content(gfile)
+	if export := s.fileExport(content); export != nil {
+		file.Name = gfile.Name + "." + export.Ext
+		if export.Link {
+			file.Size = uint64(len(s.linkContent(content)))
+			file.Mode = os.FileMode(0444)
+		} else if size, ok := s.exportSizes.get(content); ok {
+			file.Size = size
+		}
+	}
+	s.shortcutFile(gfile, file)
+	if s.rootID == "" {
+		return file
+	}
+	parents := []string{}
+	for _, p := range gfile.Parents {
+		if p != s.rootID {
+			parents = append(parents, p)
+		}
+	}
+	file.Parents = parents
+	return file
+}
+
+func queryEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
@@ -4,32 +4,59 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gohxs/cloudmount/internal/core"
 	"github.com/gohxs/cloudmount/internal/coreutil"
 	"github.com/gohxs/cloudmount/internal/fs/basefs"
-	"github.com/gohxs/cloudmount/internal/oauth2util"
 	"github.com/jacobsa/fuse/fuseops"
 
-	"golang.org/x/oauth2"
-
 	drive "google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
 )
 
 const (
-	fileFields = googleapi.Field("id, name,size,mimeType,parents,createdTime,modifiedTime,trashed")
+	fileFields = googleapi.Field("id, name,size,mimeType,parents,createdTime,modifiedTime,trashed,explicitlyTrashed,shortcutDetails")
 	gdFields   = googleapi.Field("files(" + fileFields + ")")
 )
 
 //Service gdrive service information
 type Service struct {
 	client              *drive.Service
+	transport           *coreutil.SwitchTransport // Credentials, replaced on reload
+	source              string
 	serviceConfig       Config
 	savedStartPageToken string
+	trash               bool // Expose trashed files
+
+	rootID  string          // Mount root folder ID, My Drive root or the mounted folder
+	scope   map[string]bool // Folders in mounted sub tree, nil if mounting the whole drive
+	scopeMU sync.Mutex
+
+	sharedDrives    map[string]bool // Shared drives IDs
+	sharedDrivesDir bool            // Shared drives folder was added
+	sharedDrivesMU  sync.Mutex
+
+	folders    map[string]bool        // Folders visible in mount
+	orphans    map[string]*drive.File // Files with no visible parents
+	orphansDir bool                   // Orphans folder was added
+	orphansMU  sync.Mutex
+
+	exportSizes exportSizes
+	imports     imports
 }
 
+// Assure implementation
+var (
+	_ basefs.TrashService    = &Service{}
+	_ basefs.RevisionService = &Service{}
+	_ basefs.LinkService     = &Service{}
+	_ basefs.ReloadService   = &Service{}
+)
+
 //NewService creates and initializes a new GDrive service
 func NewService(coreConfig *core.Config) *Service {
 
@@ -41,38 +68,59 @@ func NewService(coreConfig *core.Config) *Service {
 	if err != nil {
 		errlog.Fatalf("Unable to read <source>: %v", err)
 	}
-	config := &oauth2.Config{
-		ClientID:     serviceConfig.ClientSecret.ClientID,
-		ClientSecret: serviceConfig.ClientSecret.ClientSecret,
-		RedirectURL:  "urn:ietf:wg:oauth:2.0:oob", //d.serviceConfig.ClientSecret.RedirectURIs[0],
-		Scopes:       []string{drive.DriveScope},
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  "https://accounts.google.com/o/oauth2/auth",  //d.serviceConfig.ClientSecret.AuthURI,
-			TokenURL: "https://accounts.google.com/o/oauth2/token", //d.serviceConfig.ClientSecret.TokenURI,
-		},
+	settings := serviceConfig // Mount options applied, never saved
+	if opts, ok := coreConfig.DriverOptions[pname].(*Options); ok {
+		settings = opts.apply(serviceConfig)
 	}
-	if serviceConfig.Auth == nil {
-		tok := oauth2util.GetTokenFromWeb(config)
-		serviceConfig.Auth = tok
-		coreutil.SaveConfig(coreConfig.Source, &serviceConfig)
+	client, err := newClient(coreConfig.Source, &serviceConfig)
+	if err != nil {
+		errlog.Fatalf("%v", err)
 	}
-
-	client := config.Client(oauth2.NoContext, serviceConfig.Auth)
-	driveCli, err := drive.New(client)
+	transport := &coreutil.SwitchTransport{}
+	transport.Set(client.Transport)
+	driveCli, err := drive.New(&http.Client{Transport: coreutil.LimitTransport(transport)})
 	if err != nil {
 		errlog.Fatalf("Unable to retrieve drive Client: %v", err)
 	}
 
-	return &Service{client: driveCli, serviceConfig: serviceConfig}
+	s := &Service{
+		client:        driveCli,
+		transport:     transport,
+		source:        coreConfig.Source,
+		serviceConfig: settings,
+		trash:         coreConfig.Options.Trash,
+	}
+	s.resetOrphans()
+
+	// Bind mount root to 'My Drive' root folder
+	rootFile, err := s.client.Files.Get("root").Fields("id").Do()
+	if err != nil {
+		errlog.Fatalf("Unable to retrieve drive root folder: %v", err)
+	}
+	s.rootID = rootFile.Id
+
+	if coreConfig.Options.Root != "" {
+		s.rootID, err = s.resolveRoot(coreConfig.Options.Root)
+		if err != nil {
+			errlog.Fatalf("Unable to resolve root '%s': %v", coreConfig.Options.Root, err)
+		}
+		s.scope = map[string]bool{s.rootID: true}
+		log.Println("Mounting folder:", coreConfig.Options.Root, "ID:", s.rootID)
+	}
+	if err := s.resolveConvert(); err != nil {
+		errlog.Fatalf("Unable to resolve convert folders: %v", err)
+	}
+
+	return s
 
 }
 
 //Changes populate a list with changes to be handled on basefs
 func (s *Service) Changes() ([]*basefs.Change, error) { // Return a list of New file entries
 	if s.savedStartPageToken == "" {
-		startPageTokenRes, err := s.client.Changes.GetStartPageToken().Do()
+		startPageTokenRes, err := s.client.Changes.GetStartPageToken().SupportsAllDrives(true).Do()
 		if err != nil {
-			log.Println("GDrive err", err)
+			return nil, err
 		}
 		s.savedStartPageToken = startPageTokenRes.StartPageToken
 	}
@@ -80,19 +128,69 @@ func (s *Service) Changes() ([]*basefs.Change, error) { // Return a list of New
 	ret := []*basefs.Change{}
 	pageToken := s.savedStartPageToken
 	for pageToken != "" {
-		changesRes, err := s.client.Changes.List(pageToken).Fields(googleapi.Field("newStartPageToken,nextPageToken,changes(removed,fileId,file(" + fileFields + "))")).Do()
+		changesRes, err := s.client.Changes.List(pageToken).
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true).
+			Fields(googleapi.Field("newStartPageToken,nextPageToken,changes(changeType,removed,fileId,driveId,drive(id,name,createdTime),file(" + fileFields + "))")).
+			Do()
 		if err != nil {
-			log.Println("Err fetching changes", err)
-			break
+			// Changes of previous pages are applied, continue from this page
+			s.savedStartPageToken = pageToken
+			return ret, err
 		}
 		//log.Println("Changes:", len(changesRes.Changes))
 		for _, c := range changesRes.Changes {
+			if c.ChangeType == "drive" { // Shared drive itself
+				if s.scope == nil {
+					s.addFolder(c.DriveId)
+					ret = append(ret, s.sharedDriveChanges(c)...)
+				}
+				continue
+			}
 			remove := c.Removed
-			if c.File != nil && c.File.Trashed { // Might not be removed but instead trashed
+			file := s.file(c.File)
+			// Trashed files keep their parents, outside mounted sub tree or moved out
+			if c.File != nil && !remove && !s.inScope(c.File.Parents) {
 				remove = true
+				if c.File.MimeType == folderMime && s.scope != nil {
+					s.unsetScope(c.File.Id) // Listed again if moved back
+				}
+			}
+			if c.File != nil && c.File.Trashed && !remove { // Might not be removed but instead trashed
+				if s.trash {
+					file = s.trashedFile(c.File)
+				} else {
+					remove = true
+				}
 			}
-			change := &basefs.Change{ID: c.FileId, File: File(c.File), Remove: remove}
+			s.forgetOrphan(c.FileId)
+			adopted := []*basefs.Change{}
+			if c.File != nil && !c.File.Trashed && !remove && c.File.MimeType == folderMime &&
+				s.scope != nil && s.setScope(c.File.Id) {
+				// Folder moved into mounted sub tree, its contents were never listed
+				subtree, err := s.listTree(c.File.Id)
+				if err != nil {
+					log.Println("Err listing folder moved in", err)
+				}
+				for _, f := range subtree {
+					adopted = append(adopted, &basefs.Change{ID: f.Id, File: s.file(f)})
+				}
+			}
+			if c.File != nil && !c.File.Trashed && !remove && s.scope == nil {
+				if c.File.MimeType == folderMime {
+					s.addFolder(c.File.Id)
+					adopted = s.adopt(c.File.Id)
+				}
+				if !s.parentsVisible(c.File) {
+					if dirChange := s.orphansDirChange(); dirChange != nil {
+						ret = append(ret, dirChange)
+					}
+					file = s.orphanFile(c.File)
+				}
+			}
+			change := &basefs.Change{ID: c.FileId, File: file, Remove: remove}
 			ret = append(ret, change) // Convert to our changes
+			ret = append(ret, adopted...)
 		}
 		if changesRes.NewStartPageToken != "" {
 			s.savedStartPageToken = changesRes.NewStartPageToken
@@ -102,41 +200,61 @@ func (s *Service) Changes() ([]*basefs.Change, error) { // Return a list of New
 	return ret, nil
 }
 
+// Retries of a listing page failing with a server error
+const listRetries = 3
+
 //ListAll lists all files recursively to cache locally
 func (s *Service) ListAll() ([]*basefs.File, error) {
-	fileList := []*drive.File{}
-	// Service list ALL ???
-	fileMap := map[string]*drive.File{} // Temporary map by google drive fileID
+	if s.scope != nil { // Only the mounted sub tree
+		fileList, err := s.listTree(s.rootID)
+		if err != nil {
+			errlog.Println("GDrive ERR:", err)
+			return nil, err
+		}
+		files := []*basefs.File{}
+		for _, f := range fileList {
+			files = append(files, s.file(f))
+		}
+		log.Println("File count:", len(files))
+		return files, nil
+	}
 
-	r, err := s.client.Files.List().
-		OrderBy("createdTime").
-		PageSize(1000).
-		SupportsTeamDrives(true).
-		IncludeTeamDriveItems(true).
-		Fields(googleapi.Field("nextPageToken"), gdFields).
-		Do()
+	// Shared drives first, files from shared drives are parented on them
+	fileList, err := s.listSharedDrives()
 	if err != nil {
-		// Sometimes gdrive returns error 500 randomly
-		errlog.Println("GDrive ERR:", err)
-		return s.ListAll() // retry ??
-		//return nil, err
+		errlog.Println("GDrive ERR listing shared drives:", err)
+		fileList = []*drive.File{}
 	}
+	// Service list ALL ???
+	fileMap := map[string]*drive.File{} // Temporary map by google drive fileID
 
-	fileList = append(fileList, r.Files...)
-
-	// Rest of the pages
-	for r.NextPageToken != "" {
-		r, err = s.client.Files.List().
+	pageToken := ""
+	for retries := 0; ; {
+		r, err := s.client.Files.List().
 			OrderBy("createdTime").
-			PageToken(r.NextPageToken).
+			PageSize(1000).
+			PageToken(pageToken).
+			Corpora("allDrives").
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true).
 			Fields(googleapi.Field("nextPageToken"), gdFields).
 			Do()
 		if err != nil {
 			errlog.Println("GDrive ERR:", err)
-			return s.ListAll() // retry
-			//return nil, err
+			// Sometimes gdrive returns error 500 randomly
+			if gerr, ok := err.(*googleapi.Error); ok && gerr.Code >= 500 && retries < listRetries {
+				retries++
+				time.Sleep(time.Duration(retries) * time.Second)
+				continue
+			}
+			return nil, err
 		}
+		retries = 0
 		fileList = append(fileList, r.Files...)
+		if r.NextPageToken == "" {
+			break
+		}
+		pageToken = r.NextPageToken
 	}
 	log.Println("Total entries:", len(fileList))
 
@@ -147,31 +265,58 @@ func (s *Service) ListAll() ([]*basefs.File, error) {
 
 	// All fetched
 
+	s.resetOrphans()
 	files := []*basefs.File{}
+	orphans := 0
+	appended := map[string]bool{}
 	// Create clean fileList
 	var appendFile func(gfile *drive.File)
 	appendFile = func(gfile *drive.File) {
-		if gfile.Trashed {
+		if gfile.Trashed || appended[gfile.Id] {
 			return
 		}
+		appended[gfile.Id] = true
+		// Files in root, virtual or shared drive folders have no parents
+		visible := len(gfile.Parents) == 0 && gfile.Id == sharedDrivesID
 		for _, pID := range gfile.Parents {
+			if pID == s.rootID { // Mount root
+				visible = true
+				continue
+			}
 			parentFile, ok := fileMap[pID]
 			if !ok {
-				parentFile, err = s.client.Files.Get(pID).Do()
+				parentFile, err = s.client.Files.Get(pID).SupportsAllDrives(true).Fields(fileFields).Do()
 				if err != nil {
 					log.Println("Error fetching single file:", err)
 				}
-				fileMap[parentFile.Id] = parentFile
-				appendFile(parentFile) // Recurse
+				fileMap[pID] = parentFile // nil if not accessible, don't fetch again
+				if parentFile != nil {
+					appendFile(parentFile) // Recurse
+				}
+			}
+			if parentFile != nil && !parentFile.Trashed {
+				visible = true
 			}
 		}
+		if gfile.MimeType == folderMime {
+			s.addFolder(gfile.Id)
+		}
 		// Do not append directly
-		files = append(files, File(gfile)) // Add converted file
+		if !visible {
+			orphans++
+			files = append(files, s.orphanFile(gfile))
+			return
+		}
+		files = append(files, s.file(gfile)) // Add converted file
 	}
 
 	for _, f := range fileList { // Ordered
 		appendFile(f) // Check parent first
 	}
+	if orphans > 0 {
+		log.Println("Orphan files:", orphans)
+		files = append(files, s.orphansDirChange().File)
+	}
 
 	log.Println("File count:", len(files))
 
@@ -181,38 +326,70 @@ func (s *Service) ListAll() ([]*basefs.File, error) {
 
 //Create create an entry in google drive
 func (s *Service) Create(parent *basefs.File, name string, isDir bool) (*basefs.File, error) {
-	if parent == nil {
+	if isVirtualParent(parent) {
 		return nil, basefs.ErrPermission
 	}
+	parentID := s.parentID(parent)
 
 	newGFile := &drive.File{
-		Parents: []string{parent.ID},
+		Parents: []string{parentID},
 		Name:    name,
 	}
+	var imported *exportFormat
 	if isDir {
-		newGFile.MimeType = "application/vnd.google-apps.folder"
+		newGFile.MimeType = folderMime
+	} else if target, f := s.importFormat(parent, name); f != nil {
+		// Converted on upload, named without extension as drive does
+		newGFile.MimeType = target
+		newGFile.Name = strings.TrimSuffix(name, filepath.Ext(name))
+		imported = f
 	}
 	// Could be transformed to CreateFile in continer
-	createdGFile, err := s.client.Files.Create(newGFile).Fields(fileFields).Do()
+	createdGFile, err := s.client.Files.Create(newGFile).SupportsAllDrives(true).Fields(fileFields).Do()
 	if err != nil {
 		log.Println("err", err)
 		return nil, err
 	}
+	if imported != nil {
+		s.setImport(createdGFile.Id, imported)
+	}
+	if isDir && s.scope != nil {
+		s.setScope(createdGFile.Id)
+	}
 
-	return File(createdGFile), nil
+	return s.file(createdGFile), nil
 
 }
 
 //Upload a file
 func (s *Service) Upload(reader io.Reader, file *basefs.File) (*basefs.File, error) {
 	ngFile := &drive.File{}
-	up := s.client.Files.Update(file.ID, ngFile)
-	upFile, err := up.Media(reader).Fields(fileFields).Do()
+	content := s.content(file.Data.(*drive.File)) // Aliases write to target
+	up := s.client.Files.Update(content.Id, ngFile).SupportsAllDrives(true)
+	opts := []googleapi.MediaOption{}
+	// Workspace files are imported back from the exported format
+	if export := s.fileExport(content); export != nil {
+		if export.Link {
+			return nil, basefs.ErrPermission
+		}
+		mime := export.Mime
+		if export.Import != "" {
+			mime = export.Import
+		}
+		opts = append(opts, googleapi.ContentType(mime))
+	}
+	upFile, err := up.Media(reader, opts...).Fields(fileFields).Do()
 	if err != nil {
 		return nil, err
 	}
+	if content.Id != file.ID { // Keep the shortcut entry
+		upFile, err = s.client.Files.Get(file.ID).SupportsAllDrives(true).Fields(fileFields).Do()
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return File(upFile), nil
+	return s.file(upFile), nil
 }
 
 //DownloadTo from gdrive to a writer
@@ -221,23 +398,18 @@ func (s *Service) DownloadTo(w io.Writer, file *basefs.File) error {
 	var res *http.Response
 	var err error
 	// TODO :Place this in service Download
-	gfile := file.Data.(*drive.File)
-	// Export GDocs (Special google doc documents needs to be exported make a config somewhere for this)
-	switch gfile.MimeType { // Make this somewhat optional special case
-	case "application/vnd.google-apps.document":
-		log.Println("Mimes", s.serviceConfig.Mime)
-		targetMime := s.serviceConfig.Mime[gfile.MimeType]
-		log.Println("Mime before default is:", targetMime)
-		if targetMime == "" {
-			targetMime = "text/plain"
-		}
-		log.Println("Exporting doc as:", targetMime)
-
-		res, err = s.client.Files.Export(gfile.Id, targetMime).Download()
-	case "application/vnd.google-apps.spreadsheet":
-		res, err = s.client.Files.Export(gfile.Id, "text/csv").Download()
+	gfile := s.content(file.Data.(*drive.File))
+	// Export GDocs (Special google doc documents needs to be exported)
+	export := s.fileExport(gfile)
+	switch {
+	case export != nil && export.Link:
+		_, err = w.Write(s.linkContent(gfile))
+		return err
+	case export != nil:
+		log.Println("Exporting", gfile.MimeType, "as:", export.Mime)
+		res, err = s.client.Files.Export(gfile.Id, export.Mime).Download()
 	default:
-		res, err = s.client.Files.Get(gfile.Id).Download()
+		res, err = s.client.Files.Get(gfile.Id).SupportsAllDrives(true).Download()
 	}
 
 	if err != nil {
@@ -245,9 +417,13 @@ func (s *Service) DownloadTo(w io.Writer, file *basefs.File) error {
 		return err
 	}
 	defer res.Body.Close()
-	io.Copy(w, res.Body)
+	n, err := io.Copy(w, res.Body)
+	if export != nil && err == nil { // Size is only known after export
+		s.exportSizes.set(gfile, uint64(n))
+		file.Size = uint64(n)
+	}
 
-	return nil
+	return err
 }
 
 //Move a file in drive
@@ -255,29 +431,154 @@ func (s *Service) Move(file *basefs.File, newParent *basefs.File, name string) (
 	/*if newParent == nil {
 		return nil, basefs.ErrPermission
 	}*/
+	if s.isVirtualFolder(file) || isVirtualParent(newParent) {
+		return nil, basefs.ErrPermission
+	}
 	ngFile := &drive.File{
-		Name: name,
+		Name: s.cloudName(file.Data.(*drive.File), name),
 	}
 
-	updateCall := s.client.Files.Update(file.ID, ngFile).Fields(fileFields)
+	updateCall := s.client.Files.Update(file.ID, ngFile).SupportsAllDrives(true).Fields(fileFields)
+
+	s.moveParents(updateCall, file, newParent)
+	updatedFile, err := updateCall.Do()
+
+	return s.file(updatedFile), err
+}
+
+//Trash moves a file to drive trash
+func (s *Service) Trash(file *basefs.File) (*basefs.File, error) {
+	if s.isVirtualFolder(file) {
+		return nil, basefs.ErrPermission
+	}
+	trashedGFile, err := s.client.Files.Update(file.ID, &drive.File{Trashed: true}).SupportsAllDrives(true).Fields(fileFields).Do()
+	if err != nil {
+		return nil, err
+	}
+	return s.trashedFile(trashedGFile), nil
+}
+
+//ListTrash lists all trashed files
+func (s *Service) ListTrash() ([]*basefs.File, error) {
+	fileList := []*drive.File{}
+	pageToken := ""
+	for {
+		r, err := s.client.Files.List().
+			Q("trashed = true").
+			Corpora("allDrives").
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true).
+			PageSize(1000).
+			PageToken(pageToken).
+			Fields(googleapi.Field("nextPageToken"), gdFields).
+			Do()
+		if err != nil {
+			return nil, err
+		}
+		fileList = append(fileList, r.Files...)
+		if r.NextPageToken == "" {
+			break
+		}
+		pageToken = r.NextPageToken
+	}
 
-	if !file.HasParent(newParent) {
-		for _, pgid := range file.Parents {
-			updateCall.RemoveParents(pgid) // Remove all parents??
+	trashedMap := map[string]bool{}
+	for _, f := range fileList {
+		trashedMap[f.Id] = true
+	}
+	files := []*basefs.File{}
+	for _, f := range fileList {
+		file := s.trashedFile(f)
+		parentTrashed := false
+		for _, pID := range f.Parents {
+			parentTrashed = parentTrashed || trashedMap[pID]
 		}
-		if newParent != nil {
-			updateCall.AddParents(newParent.ID)
+		if !parentTrashed && !s.inScope(f.Parents) { // Trashed outside mounted sub tree
+			continue
 		}
+		if !parentTrashed { // Parent is not in trash, place it on trash root
+			file.Parents = []string{basefs.TrashID}
+		}
+		files = append(files, file)
 	}
-	updatedFile, err := updateCall.Do()
+	return files, nil
+}
+
+//Restore untrash a file and move it to newParent
+func (s *Service) Restore(file *basefs.File, newParent *basefs.File, name string) (*basefs.File, error) {
+	ngFile := &drive.File{
+		Name:            s.cloudName(file.Data.(*drive.File), name),
+		Trashed:         false,
+		ForceSendFields: []string{"Trashed"},
+	}
+	if isVirtualParent(newParent) {
+		return nil, basefs.ErrPermission
+	}
+	updateCall := s.client.Files.Update(file.ID, ngFile).SupportsAllDrives(true).Fields(fileFields)
+	s.moveParents(updateCall, file, newParent)
+	restoredFile, err := updateCall.Do()
+	if err != nil {
+		return nil, err
+	}
+	return s.file(restoredFile), nil
+}
+
+//Revisions lists file revisions, google docs revisions are not downloadable
+func (s *Service) Revisions(file *basefs.File) ([]*basefs.File, error) {
+	gfile := file.Data.(*drive.File)
+	if strings.HasPrefix(gfile.MimeType, "application/vnd.google-apps.") {
+		return nil, nil
+	}
+	ret := []*basefs.File{}
+	pageToken := ""
+	for {
+		r, err := s.client.Revisions.List(file.ID).
+			PageToken(pageToken).
+			Fields(googleapi.Field("nextPageToken,revisions(id,modifiedTime,size)")).
+			Do()
+		if err != nil {
+			return nil, err
+		}
+		for _, rev := range r.Revisions {
+			modifiedTime, _ := time.Parse(time.RFC3339, rev.ModifiedTime)
+			ret = append(ret, &basefs.File{
+				ID:           rev.Id,
+				Name:         file.Name,
+				Size:         uint64(rev.Size),
+				CreatedTime:  modifiedTime,
+				ModifiedTime: modifiedTime,
+				AccessedTime: modifiedTime,
+				Mode:         os.FileMode(0444),
+				Data:         rev,
+			})
+		}
+		if r.NextPageToken == "" {
+			break
+		}
+		pageToken = r.NextPageToken
+	}
+	return ret, nil
+}
 
-	return File(updatedFile), err
+//DownloadRevisionTo downloads a file revision to a writer
+func (s *Service) DownloadRevisionTo(w io.Writer, file *basefs.File, revision *basefs.File) error {
+	res, err := s.client.Revisions.Get(file.ID, revision.ID).Download()
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(w, res.Body)
+
+	return err
 }
 
 //Delete file from drive
 func (s *Service) Delete(file *basefs.File) error {
 	// PRevent removing from root?
-	err := s.client.Files.Delete(file.ID).Do()
+	if s.isVirtualFolder(file) {
+		return basefs.ErrPermission
+	}
+	err := s.client.Files.Delete(file.ID).SupportsAllDrives(true).Do()
 	if err != nil {
 		return err
 	}
@@ -299,6 +600,33 @@ func (s *Service) StatFS(op *fuseops.StatFSOp) error {
 	return nil
 }
 
+// moveParents changes the drive parents in updateCall if moving to newParent
+func (s *Service) moveParents(updateCall *drive.FilesUpdateCall, file *basefs.File, newParent *basefs.File) {
+	gfile := file.Data.(*drive.File) // Real drive parents
+	newParentID := s.parentID(newParent)
+	for _, p := range gfile.Parents {
+		if p == newParentID { // Same parent
+			return
+		}
+	}
+	if len(gfile.Parents) > 0 {
+		updateCall.RemoveParents(strings.Join(gfile.Parents, ","))
+	}
+	if newParentID != "" {
+		updateCall.AddParents(newParentID)
+	}
+}
+
+// trashedFile converts a trashed google drive file, explicitly trashed files
+// are placed in trash root
+func (s *Service) trashedFile(gfile *drive.File) *basefs.File {
+	file := s.file(gfile)
+	if gfile.ExplicitlyTrashed {
+		file.Parents = []string{basefs.TrashID}
+	}
+	return file
+}
+
 //File converts a google drive File structure to baseFS
 func File(gfile *drive.File) *basefs.File {
 	if gfile == nil {
@@ -0,0 +1,94 @@
+package gdrivefs
+
+import (
+	"github.com/gohxs/cloudmount/internal/fs/basefs"
+
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Shared drives are placed as folders inside a virtual folder in mount root
+const (
+	sharedDrivesID   = "cloudmount:shared-drives"
+	sharedDrivesName = "Shared drives"
+)
+
+// listSharedDrives lists all shared drives as folders parented on the virtual
+// shared drives folder, the folder itself is included if there is any drive
+func (s *Service) listSharedDrives() ([]*drive.File, error) {
+	ret := []*drive.File{}
+	sharedDrives := map[string]bool{}
+	pageToken := ""
+	for {
+		r, err := s.client.Drives.List().
+			PageSize(100).
+			PageToken(pageToken).
+			Fields(googleapi.Field("nextPageToken,drives(id,name,createdTime)")).
+			Do()
+		if err != nil {
+			s.sharedDrivesMU.Lock()
+			s.sharedDrivesDir = false // Not listed, added with the first drive change
+			s.sharedDrivesMU.Unlock()
+			return nil, err
+		}
+		for _, d := range r.Drives {
+			sharedDrives[d.Id] = true
+			ret = append(ret, sharedDriveFile(d))
+		}
+		if r.NextPageToken == "" {
+			break
+		}
+		pageToken = r.NextPageToken
+	}
+	s.sharedDrivesMU.Lock()
+	s.sharedDrives = sharedDrives
+	s.sharedDrivesDir = len(ret) > 0
+	s.sharedDrivesMU.Unlock()
+
+	if len(ret) == 0 {
+		return ret, nil
+	}
+	return append([]*drive.File{sharedDrivesDirFile()}, ret...), nil
+}
+
+// sharedDriveChanges converts a shared drive change (added, renamed or
+// removed), the virtual folder is added first if there were no drives
+func (s *Service) sharedDriveChanges(c *drive.Change) []*basefs.Change {
+	s.sharedDrivesMU.Lock()
+	defer s.sharedDrivesMU.Unlock()
+
+	if c.Removed || c.Drive == nil {
+		delete(s.sharedDrives, c.DriveId)
+		return []*basefs.Change{{ID: c.DriveId, Remove: true}}
+	}
+	if s.sharedDrives == nil {
+		s.sharedDrives = map[string]bool{}
+	}
+	s.sharedDrives[c.DriveId] = true
+	ret := []*basefs.Change{}
+	if !s.sharedDrivesDir {
+		s.sharedDrivesDir = true
+		ret = append(ret, &basefs.Change{ID: sharedDrivesID, File: File(sharedDrivesDirFile())})
+	}
+	return append(ret, &basefs.Change{ID: c.DriveId, File: File(sharedDriveFile(c.Drive))})
+}
+
+func sharedDrivesDirFile() *drive.File {
+	return &drive.File{
+		Id:       sharedDrivesID,
+		Name:     sharedDrivesName,
+		MimeType: folderMime,
+	}
+}
+
+// sharedDriveFile a shared drive as a folder, shared drive root folder ID is the drive ID
+func sharedDriveFile(d *drive.Drive) *drive.File {
+	return &drive.File{
+		Id:           d.Id,
+		Name:         d.Name,
+		MimeType:     folderMime,
+		CreatedTime:  d.CreatedTime,
+		ModifiedTime: d.CreatedTime,
+		Parents:      []string{sharedDrivesID},
+	}
+}
@@ -0,0 +1,74 @@
+package gdrivefs
+
+import (
+	"os"
+
+	"github.com/gohxs/cloudmount/internal/fs/basefs"
+
+	drive "google.golang.org/api/drive/v3"
+)
+
+// Drive shortcuts are shown as symlinks to the target path in the mount or
+// as aliases serving the target content, set in source config:
+//   shortcuts: alias # default symlink
+// Folder shortcuts are always symlinks since a folder can't be in two places
+const (
+	shortcutMime = workspacePrefix + "shortcut"
+
+	shortcutsSymlink = "symlink"
+	shortcutsAlias   = "alias"
+)
+
+// isAlias checks if gfile is a shortcut served as its target
+func (s *Service) isAlias(gfile *drive.File) bool {
+	return gfile.MimeType == shortcutMime && gfile.ShortcutDetails != nil &&
+		s.serviceConfig.Shortcuts == shortcutsAlias &&
+		gfile.ShortcutDetails.TargetMimeType != folderMime
+}
+
+// content returns the drive file holding gfile content, the target for aliases
+func (s *Service) content(gfile *drive.File) *drive.File {
+	if !s.isAlias(gfile) {
+		return gfile
+	}
+	return &drive.File{
+		Id:           gfile.ShortcutDetails.TargetId,
+		Name:         gfile.Name,
+		MimeType:     gfile.ShortcutDetails.TargetMimeType,
+		ModifiedTime: gfile.ModifiedTime,
+	}
+}
+
+// shortcutFile sets symlink attributes on shortcut files
+func (s *Service) shortcutFile(gfile *drive.File, file *basefs.File) {
+	if gfile.MimeType != shortcutMime || gfile.ShortcutDetails == nil || s.isAlias(gfile) {
+		return
+	}
+	file.Mode = os.FileMode(0777) | os.ModeSymlink
+	file.Link = gfile.ShortcutDetails.TargetId
+}
+
+// CreateLink creates a drive shortcut to target
+func (s *Service) CreateLink(parent *basefs.File, name string, target *basefs.File) (*basefs.File, error) {
+	if isVirtualParent(parent) || isVirtualParent(target) {
+		return nil, basefs.ErrPermission
+	}
+	targetID := s.parentID(target)
+	if target != nil {
+		if gtarget, ok := target.Data.(*drive.File); ok && gtarget.ShortcutDetails != nil {
+			targetID = gtarget.ShortcutDetails.TargetId // No shortcuts to shortcuts
+		}
+	}
+	newGFile := &drive.File{
+		Parents:         []string{s.parentID(parent)},
+		Name:            name,
+		MimeType:        shortcutMime,
+		ShortcutDetails: &drive.FileShortcutDetails{TargetId: targetID},
+	}
+	createdGFile, err := s.client.Files.Create(newGFile).SupportsAllDrives(true).Fields(fileFields).Do()
+	if err != nil {
+		log.Println("err", err)
+		return nil, err
+	}
+	return s.file(createdGFile), nil
+}
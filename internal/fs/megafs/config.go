@@ -1,10 +1,26 @@
 package megafs
 
+import "github.com/gohxs/cloudmount/internal/coreutil"
+
 //Config  mega.yaml config file structure
 type Config struct {
+	Type         string `json:"type,omitempty" yaml:"type,omitempty"`                   // Read by core
+	Root         string `json:"root,omitempty" yaml:"root,omitempty"`                   // Read by core
+	MountOptions string `json:"mount_options,omitempty" yaml:"mount_options,omitempty"` // Read by core
 	// Fs service specific configuration here
 	Credentials struct {
 		Email    string
 		Password string
 	}
 }
+
+// Validate checks required credentials
+func (c *Config) Validate() error {
+	if c.Credentials.Email == "" {
+		return &coreutil.FieldError{Field: "credentials.email", Msg: "required"}
+	}
+	if c.Credentials.Password == "" {
+		return &coreutil.FieldError{Field: "credentials.password", Msg: "required"}
+	}
+	return nil
+}
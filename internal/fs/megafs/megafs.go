@@ -2,23 +2,20 @@ package megafs
 
 import (
 	"github.com/gohxs/cloudmount/internal/core"
+	"github.com/gohxs/cloudmount/internal/coreutil"
 	"github.com/gohxs/cloudmount/internal/fs/basefs"
 	"github.com/gohxs/prettylog"
 )
 
 var (
 	pname  = "mega"
-	log    = prettylog.Dummy()
+	log    = coreutil.VerboseLogger(pname, 1)
 	errlog = prettylog.New(pname + "-err")
 )
 
 // New Filesystem implementation based on basefs(webfs) Service
 func New(core *core.Core) core.DriverFS {
 
-	if core.Config.VerboseLog {
-		log = prettylog.New(pname)
-	}
-
 	fs := basefs.New(core)
 	fs.Service = NewService(&core.Config, fs)
 
@@ -1,10 +1,12 @@
 package megafs
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/gohxs/cloudmount/internal/core"
 	"github.com/gohxs/cloudmount/internal/coreutil"
@@ -16,10 +18,19 @@ import (
 
 //Service gdrive service information
 type Service struct {
-	megaCli *mega.Mega
-	basefs  *basefs.BaseFS
+	megaCli  *mega.Mega
+	basefs   *basefs.BaseFS
+	rootNode *mega.Node // Mount root, nil for account root
+
+	// Mega does not keep where trashed nodes came from, when mounting a sub
+	// folder only nodes trashed from this mount are listed in trash
+	trashed   map[string]bool
+	trashedMU sync.Mutex
 }
 
+// Assure implementation
+var _ basefs.TrashService = &Service{}
+
 //NewService creates and initializes a new Mega service
 func NewService(coreConfig *core.Config, basefs *basefs.BaseFS) *Service {
 
@@ -35,8 +46,51 @@ func NewService(coreConfig *core.Config, basefs *basefs.BaseFS) *Service {
 	m := mega.New()
 	m.Login(serviceConfig.Credentials.Email, serviceConfig.Credentials.Password)
 
-	return &Service{m, basefs}
+	s := &Service{megaCli: m, basefs: basefs, trashed: map[string]bool{}}
+	if coreConfig.Options.Root != "" {
+		s.rootNode, err = s.resolveRoot(coreConfig.Options.Root)
+		if err != nil {
+			errlog.Fatalf("Unable to resolve root '%s': %v", coreConfig.Options.Root, err)
+		}
+		log.Println("Mounting folder:", coreConfig.Options.Root)
+	}
 
+	return s
+}
+
+// resolveRoot resolves a folder path or node hash into a mega node
+func (s *Service) resolveRoot(root string) (*mega.Node, error) {
+	if !strings.Contains(root, "/") {
+		if n := s.megaCli.FS.HashLookup(root); n != nil && n.GetType() == mega.FOLDER {
+			return n, nil
+		}
+	}
+	names := []string{}
+	for _, name := range strings.Split(root, "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	nodes, err := s.megaCli.FS.PathLookup(s.megaCli.FS.GetRoot(), names)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return s.megaCli.FS.GetRoot(), nil
+	}
+	n := nodes[len(nodes)-1]
+	if n.GetType() != mega.FOLDER {
+		return nil, fmt.Errorf("'%s' is not a folder", root)
+	}
+	return n, nil
+}
+
+// root returns the mount root node
+func (s *Service) root() *mega.Node {
+	if s.rootNode != nil {
+		return s.rootNode
+	}
+	return s.megaCli.FS.GetRoot()
 }
 
 //Changes populate a list with changes to be handled on basefs
@@ -44,15 +98,17 @@ func NewService(coreConfig *core.Config, basefs *basefs.BaseFS) *Service {
 func (s *Service) Changes() ([]*basefs.Change, error) {
 
 	// It seems that the mega package caches entries and refreshes necessary by its own, it should be fast to refresh all
-	s.basefs.Refresh()
-	return nil, nil
+	return nil, s.basefs.Refresh()
 }
 
 //ListAll lists all files recursively to cache locally
 func (s *Service) ListAll() ([]*basefs.File, error) {
-	ret := []*basefs.File{}
+	return s.listNode(s.root(), ""), nil
+}
 
-	rootNode := s.megaCli.FS.GetRoot()
+// listNode lists node children recursively, paths are prefixed with rootPath
+func (s *Service) listNode(node *mega.Node, rootPath string) []*basefs.File {
+	ret := []*basefs.File{}
 
 	var addAll func(*mega.Node, string) // Closure that basically appends entries to local ret
 	addAll = func(n *mega.Node, pathstr string) {
@@ -70,10 +126,9 @@ func (s *Service) ListAll() ([]*basefs.File, error) {
 		}
 	}
 
-	addAll(rootNode, "")
-
-	return ret, nil
+	addAll(node, rootPath)
 
+	return ret
 }
 
 //Create create an entry in google drive
@@ -81,7 +136,7 @@ func (s *Service) Create(parent *basefs.File, name string, isDir bool) (*basefs.
 	parentID := ""
 	var megaParent *mega.Node
 	if parent == nil {
-		megaParent = s.megaCli.FS.GetRoot()
+		megaParent = s.root()
 	} else {
 		parentID = parent.ID
 		megaParent = parent.Data.(*MegaPath).Node
@@ -123,10 +178,13 @@ func (s *Service) Upload(reader io.Reader, file *basefs.File) (*basefs.File, err
 	var megaParent *mega.Node
 	parentID := ""
 	if len(file.Parents) == 0 {
-		megaParent = s.megaCli.FS.GetRoot()
+		megaParent = s.root()
 	} else {
 		parentEntry := s.basefs.Root.FindByID(file.Parents[0])
-		megaPath := parentEntry.File.Data.(*MegaPath)
+		megaPath, ok := parentEntry.File.Data.(*MegaPath)
+		if !ok { // Virtual parent (i.e: trash)
+			return nil, basefs.ErrPermission
+		}
 		parentID = megaPath.Path
 		megaParent = megaPath.Node
 	}
@@ -168,26 +226,96 @@ func (s *Service) Move(file *basefs.File, newParent *basefs.File, name string) (
 		megaParent = newParent.Data.(*MegaPath).Node
 		newParentID = newParent.ID
 	} else {
-		megaParent = s.megaCli.FS.GetRoot()
+		megaParent = s.root()
 	}
-	err := s.megaCli.Move(file.Data.(*MegaPath).Node, megaParent)
+	node := file.Data.(*MegaPath).Node
+	err := s.megaCli.Move(node, megaParent)
 	if err != nil {
 		return nil, err
 	}
 	// Change parent in file.Data or return new
 	if file.Name != name {
-		err := s.megaCli.Rename(file.Data.(*MegaPath).Node, name)
+		err := s.megaCli.Rename(node, name)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return File(&MegaPath{Path: newParentID + "/" + name, Node: file.Data.(*MegaPath).Node}), nil
+	newPath := newParentID + "/" + name
+	s.moveChildren(node, file.ID, newPath)
+	return File(&MegaPath{Path: newPath, Node: node}), nil
 }
 
 //Delete file from service
 func (s *Service) Delete(file *basefs.File) error {
-	return s.megaCli.Delete(file.Data.(*MegaPath).Node, false)
+	return s.megaCli.Delete(file.Data.(*MegaPath).Node, true)
+}
+
+//Trash moves file to mega rubbish bin
+func (s *Service) Trash(file *basefs.File) (*basefs.File, error) {
+	node := file.Data.(*MegaPath).Node
+	err := s.megaCli.Move(node, s.megaCli.FS.GetTrash())
+	if err != nil {
+		return nil, err
+	}
+	s.trashedMU.Lock()
+	s.trashed[node.GetHash()] = true
+	s.trashedMU.Unlock()
+	newPath := basefs.TrashID + "/" + node.GetName()
+	s.moveChildren(node, file.ID, newPath)
+	return File(&MegaPath{Path: newPath, Node: node}), nil
+}
+
+// moveChildren updates the entries under a moved folder, IDs are paths so
+// its children are listed again under the new path keeping their inodes
+func (s *Service) moveChildren(node *mega.Node, oldPath, newPath string) {
+	if node.GetType() != mega.FOLDER || oldPath == newPath {
+		return
+	}
+	moveEntries(s.basefs.Root, s.listNode(node, newPath), oldPath, newPath)
+}
+
+// moveEntries replaces the entries of files listed under newPath with their
+// entries under oldPath keeping the inodes, parents listed before children
+func moveEntries(root *basefs.FileContainer, files []*basefs.File, oldPath, newPath string) {
+	for _, f := range files {
+		entry := root.FindByID(oldPath + strings.TrimPrefix(f.ID, newPath))
+		if entry == nil {
+			continue
+		}
+		root.RemoveEntry(entry)
+		root.FileEntry(f, entry.Inode)
+	}
+}
+
+//ListTrash lists files in mega rubbish bin
+func (s *Service) ListTrash() ([]*basefs.File, error) {
+	if s.rootNode == nil {
+		return s.listNode(s.megaCli.FS.GetTrash(), basefs.TrashID), nil
+	}
+	children, err := s.megaCli.FS.GetChildren(s.megaCli.FS.GetTrash())
+	if err != nil {
+		return nil, err
+	}
+	s.trashedMU.Lock()
+	defer s.trashedMU.Unlock()
+	ret := []*basefs.File{}
+	for _, n := range children {
+		if !s.trashed[n.GetHash()] { // Trashed outside mount root
+			continue
+		}
+		spath := basefs.TrashID + "/" + n.GetName()
+		ret = append(ret, File(&MegaPath{Path: spath, Node: n}))
+		if n.GetType() == mega.FOLDER {
+			ret = append(ret, s.listNode(n, spath)...)
+		}
+	}
+	return ret, nil
+}
+
+//Restore moves file from rubbish bin into newParent
+func (s *Service) Restore(file *basefs.File, newParent *basefs.File, name string) (*basefs.File, error) {
+	return s.Move(file, newParent, name)
 }
 
 func (s *Service) StatFS(*fuseops.StatFSOp) error {
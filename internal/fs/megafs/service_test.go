@@ -0,0 +1,75 @@
+package megafs
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gohxs/cloudmount/internal/core"
+	"github.com/gohxs/cloudmount/internal/fs/basefs"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// file as listed by listNode, IDs and parents are paths
+func file(p string, dir bool) *basefs.File {
+	f := &basefs.File{ID: p, Name: path.Base(p), Mode: os.FileMode(0644)}
+	if dir {
+		f.Mode = os.FileMode(0755) | os.ModeDir
+	}
+	if parent := path.Dir(p); parent != "/" {
+		f.Parents = []string{parent}
+	}
+	return f
+}
+
+func TestMoveEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		newPath string
+	}{
+		{"move", "/other/renamed"},
+		{"trash", basefs.TrashID + "/docs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := basefs.New(&core.Core{})
+			for _, f := range []*basefs.File{
+				file("/docs", true), file("/docs/sub", true), file("/docs/sub/a.txt", false),
+				file("/docs/b.txt", false), file("/docsb.txt", false), file("/other", true),
+			} {
+				fs.Root.FileEntry(f)
+			}
+			inodes := map[string]fuseops.InodeID{}
+			for _, id := range []string{"/docs/sub", "/docs/sub/a.txt", "/docs/b.txt"} {
+				inodes[id] = fs.Root.FindByID(id).Inode
+			}
+			// Moved folder entry is replaced by basefs, its children here
+			moved := fs.Root.FindByID("/docs")
+			fs.Root.RemoveEntry(moved)
+			fs.Root.FileEntry(file(tt.newPath, true), moved.Inode)
+
+			n := tt.newPath
+			moveEntries(fs.Root, []*basefs.File{
+				file(n+"/sub", true), file(n+"/sub/a.txt", false), file(n+"/b.txt", false),
+			}, "/docs", n)
+
+			for old, inode := range inodes {
+				if fs.Root.FindByID(old) != nil {
+					t.Errorf("%s still listed", old)
+				}
+				id := n + old[len("/docs"):]
+				entry := fs.Root.FindByID(id)
+				if entry == nil || entry.Inode != inode {
+					t.Errorf("%s = %+v, want inode %d", id, entry, inode)
+				}
+			}
+			if fs.Root.FindByID("/docsb.txt") == nil {
+				t.Error("sibling with the same prefix moved")
+			}
+			sub := fs.Root.LookupByID(n, "sub")
+			if sub == nil || fs.Root.Lookup(sub, "a.txt") == nil {
+				t.Errorf("children not found under %s", n)
+			}
+		})
+	}
+}
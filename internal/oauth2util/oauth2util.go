@@ -1,34 +1,286 @@
 package oauth2util
 
 import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
+	"golang.org/x/sys/unix"
 )
 
-//GetTokenFromWeb shows link to user, and requests the informed token
-func GetTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	//authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	authURL := config.AuthCodeURL("state-token")
+// Time to wait for the user to authorize
+const authTimeout = 10 * time.Minute
 
-	fmt.Printf(
+//GetTokenFromWeb requests authorization from the user, the code is captured by a
+// loopback listener if config.RedirectURL is a loopback address and there is a
+// browser, with device code if there is no browser and the provider supports
+// it, or pasted by the user as last fallback, opts are provider specific
+// authorization parameters
+func GetTokenFromWeb(config *oauth2.Config, opts ...oauth2.AuthCodeOption) *oauth2.Token {
+	ctx, cancel := context.WithTimeout(context.Background(), authTimeout)
+	defer cancel()
+
+	var tok *oauth2.Token
+	var err error
+	switch {
+	case isLoopback(config.RedirectURL) && hasBrowser():
+		tok, err = LoopbackToken(ctx, config, os.Stdout, os.Stdin, opts...)
+	case config.Endpoint.DeviceAuthURL != "":
+		tok, err = DeviceToken(ctx, config, os.Stdout, opts...)
+		if err != nil {
+			log.Println("Device code flow failed, falling back:", err)
+			tok, err = PasteToken(ctx, config, os.Stdout, os.Stdin, opts...)
+		}
+	default:
+		tok, err = PasteToken(ctx, config, os.Stdout, os.Stdin, opts...)
+	}
+	if err != nil {
+		log.Fatalf("Unable to retrieve token from web: %v", err)
+	}
+	return tok
+}
+
+// LoopbackToken starts a temporary http listener on localhost as redirect URI
+// and captures the authorization code, if in is not nil the redirected URL or
+// the code can also be pasted (i.e: browser in another machine)
+func LoopbackToken(ctx context.Context, config *oauth2.Config, out io.Writer, in io.Reader, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+
+	cfg := *config
+	cfg.RedirectURL = fmt.Sprintf("http://%s/", ln.Addr())
+	state := randomState()
+	verifier := oauth2.GenerateVerifier()
+	authURL := cfg.AuthCodeURL(state, authOptions(verifier, opts)...)
+
+	type result struct {
+		code string
+		err  error
+	}
+	resCh := make(chan result, 1)
+	send := func(r result) {
+		select {
+		case resCh <- r:
+		default: // Already got one
+		}
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("state") != state { // i.e: favicon
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			return
+		}
+		if e := q.Get("error"); e != "" {
+			fmt.Fprintln(w, "cloudmount authorization failed, you can close this window")
+			send(result{err: fmt.Errorf("authorization failed: %s %s", e, q.Get("error_description"))})
+			return
+		}
+		fmt.Fprintln(w, "cloudmount authorized, you can close this window")
+		send(result{code: q.Get("code")})
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	printAuthURL(out, authURL, "waiting for authorization, or paste the redirected URL: ")
+	openBrowser(authURL)
+	if in != nil {
+		in, stop := interruptible(in)
+		defer stop() // Stop reading once authorized
+		go func() {
+			code, err := readCode(in, state)
+			if err == nil {
+				send(result{code: code})
+			}
+		}()
+	}
+
+	var res result
+	select {
+	case res = <-resCh:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	return cfg.Exchange(ctx, res.code, oauth2.VerifierOption(verifier))
+}
+
+// DeviceToken authorizes with device code flow, user enters a code in
+// another device
+func DeviceToken(ctx context.Context, config *oauth2.Config, out io.Writer, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	resp, err := config.DeviceAuth(ctx, append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	verificationURL := resp.VerificationURI
+	if resp.VerificationURIComplete != "" {
+		verificationURL = resp.VerificationURIComplete
+	}
+	fmt.Fprintf(out, "Go to %s in any device and enter the code: %s\n", verificationURL, resp.UserCode)
+	return config.DeviceAccessToken(ctx, resp)
+}
+
+// PasteToken shows the authorization link and reads the pasted code
+func PasteToken(ctx context.Context, config *oauth2.Config, out io.Writer, in io.Reader, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	state := randomState()
+	verifier := oauth2.GenerateVerifier()
+	authURL := config.AuthCodeURL(state, authOptions(verifier, opts)...)
+
+	printAuthURL(out, authURL, "type the authorization code: ")
+	code, err := readCode(in, state)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read authorization code: %v", err)
+	}
+	return config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+}
+
+// authOptions requests offline access (refresh token) with PKCE challenge
+func authOptions(verifier string, opts []oauth2.AuthCodeOption) []oauth2.AuthCodeOption {
+	return append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier)}, opts...)
+}
+
+func printAuthURL(out io.Writer, authURL, prompt string) {
+	fmt.Fprintf(out,
 		`Go to the following link in your browser: 
 ----------------------------------------------------------------------------------------------
 %v
 ----------------------------------------------------------------------------------------------
 
-type the authorization code: `, authURL)
+%s`, authURL, prompt)
+}
 
-	var code string
-	if _, err := fmt.Scan(&code); err != nil {
-		log.Fatalf("Unable to read authorization code %v", err)
+// readCode reads a code or a redirected URL containing the code
+func readCode(in io.Reader, state string) (string, error) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Query().Get("code") == "" { // Plain code
+			return line, nil
+		}
+		if u.Query().Get("state") != state {
+			return "", errors.New("invalid state in redirected URL")
+		}
+		return u.Query().Get("code"), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
 	}
+	return "", io.EOF
+}
 
-	tok, err := config.Exchange(oauth2.NoContext, code)
-	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+// interruptible returns a reader for in that stops reading when stop is
+// called, files (i.e: stdin) are only read once poll reports input so no
+// read is left pending and the file flags are untouched
+func interruptible(in io.Reader) (io.Reader, func()) {
+	f, ok := in.(*os.File)
+	if !ok {
+		return in, func() {}
+	}
+	r := &pollReader{fd: int(f.Fd()), done: make(chan struct{})}
+	return r, func() {
+		close(r.done)
+		r.mu.Lock() // Wait for a running Read
+		r.mu.Unlock()
 	}
+}
 
-	return tok
+// pollReader reads fd while done is open
+type pollReader struct {
+	mu   sync.Mutex
+	fd   int
+	done chan struct{}
+}
+
+func (r *pollReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fds := []unix.PollFd{{Fd: int32(r.fd), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-r.done:
+			return 0, io.EOF
+		default:
+		}
+		n, err := unix.Poll(fds, 100)
+		if err == unix.EINTR || err == nil && n == 0 {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		n, err = unix.Read(r.fd, p)
+		if n <= 0 && err == nil {
+			return 0, io.EOF
+		}
+		if n < 0 {
+			n = 0
+		}
+		return n, err
+	}
+}
+
+func randomState() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Unable to generate state: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// isLoopback checks if redirectURL can be served by a local listener
+func isLoopback(redirectURL string) bool {
+	u, err := url.Parse(redirectURL)
+	if err != nil || u.Scheme != "http" {
+		return false
+	}
+	host := u.Hostname()
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+func hasBrowser() bool {
+	if runtime.GOOS != "linux" {
+		return true
+	}
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// openBrowser tries to open url, errors are ignored since the link is printed
+func openBrowser(url string) {
+	if !hasBrowser() {
+		return
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err == nil {
+		go cmd.Wait()
+	}
 }
@@ -0,0 +1,316 @@
+package oauth2util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// stubProvider authorization server, the token endpoint checks the PKCE
+// verifier against the challenge of the authorization request
+type stubProvider struct {
+	*httptest.Server
+	t         *testing.T
+	challenge string
+	redirect  string
+	polls     int // Device token requests
+}
+
+const deviceGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+func newStubProvider(t *testing.T) *stubProvider {
+	p := &stubProvider{t: t}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/device":
+			if r.Form.Get("access_type") != "offline" {
+				t.Errorf("no offline access in device request %v", r.Form)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"device_code": "the-device", "user_code": "ABCD-EFGH", "verification_uri": p.URL + "/verify",
+				"expires_in": 60, "interval": 1,
+			})
+			return
+		case r.Form.Get("grant_type") == deviceGrant:
+			if r.Form.Get("device_code") != "the-device" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+			if p.polls++; p.polls == 1 { // User has not entered the code yet
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"authorization_pending"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "device-access", "refresh_token": "refresh", "token_type": "Bearer", "expires_in": 3600,
+			})
+			return
+		case r.Form.Get("grant_type") == "refresh_token":
+			if r.Form.Get("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "refreshed", "token_type": "Bearer", "expires_in": 3600,
+			})
+			return
+		}
+		if r.Form.Get("code") != "the-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			http.Error(w, `{"error":"invalid_grant","error_description":"PKCE"}`, http.StatusBadRequest)
+			return
+		}
+		if r.Form.Get("redirect_uri") != p.redirect {
+			http.Error(w, `{"error":"invalid_grant","error_description":"redirect_uri"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access", "refresh_token": "refresh", "token_type": "Bearer", "expires_in": 3600,
+		})
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *stubProvider) config(redirect string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:    "id",
+		RedirectURL: redirect,
+		Endpoint:    oauth2.Endpoint{AuthURL: p.URL + "/auth", TokenURL: p.URL + "/token", DeviceAuthURL: p.URL + "/device"},
+	}
+}
+
+// authorize checks the authorization URL and returns its query
+func (p *stubProvider) authorize(authURL string) url.Values {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		p.t.Errorf("no PKCE challenge in %s", authURL)
+	}
+	if q.Get("access_type") != "offline" {
+		p.t.Errorf("no offline access in %s", authURL)
+	}
+	p.challenge = q.Get("code_challenge")
+	p.redirect = q.Get("redirect_uri")
+	return q
+}
+
+// urlWriter sends the printed authorization link
+type urlWriter chan string
+
+var linkRe = regexp.MustCompile(`https?://\S+`)
+
+func (w urlWriter) Write(b []byte) (int, error) {
+	if link := linkRe.Find(b); link != nil {
+		w <- string(link)
+	}
+	return len(b), nil
+}
+
+func noBrowser(t *testing.T) {
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+}
+
+func TestLoopbackToken(t *testing.T) {
+	noBrowser(t)
+	p := newStubProvider(t)
+	out := make(urlWriter, 1)
+
+	// Stdin is still waiting for a pasted URL when the browser redirects
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	go func() {
+		q := p.authorize(<-out)
+		if !isLoopback(p.redirect) {
+			t.Errorf("redirect %s is not loopback", p.redirect)
+		}
+		res, err := http.Get(p.redirect + "?state=bad&code=the-code")
+		if err == nil {
+			res.Body.Close()
+		}
+		res, err = http.Get(p.redirect + "?state=" + url.QueryEscape(q.Get("state")) + "&code=the-code")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		res.Body.Close()
+	}()
+	tok, err := LoopbackToken(context.Background(), p.config("http://127.0.0.1"), out, r)
+	if err != nil {
+		t.Fatalf("LoopbackToken: %v", err)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" {
+		t.Errorf("token = %+v", tok)
+	}
+
+	// The stdin reader ends with the authorization, later input is not taken
+	io.WriteString(w, "later input\n")
+	r.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 64)
+	n, err := r.Read(buf)
+	if string(buf[:n]) != "later input\n" {
+		t.Errorf("stdin read after authorization = %q, %v", buf[:n], err)
+	}
+}
+
+func TestLoopbackTokenPasted(t *testing.T) {
+	noBrowser(t)
+	p := newStubProvider(t)
+	out := make(urlWriter, 1)
+	in, paste := io.Pipe()
+	defer paste.Close()
+
+	go func() {
+		q := p.authorize(<-out)
+		io.WriteString(paste, "\n"+p.redirect+"?state="+url.QueryEscape(q.Get("state"))+"&code=the-code\n")
+	}()
+	tok, err := LoopbackToken(context.Background(), p.config("http://127.0.0.1"), out, in)
+	if err != nil || tok.AccessToken != "access" {
+		t.Fatalf("LoopbackToken = %+v, %v", tok, err)
+	}
+}
+
+func TestLoopbackTokenDenied(t *testing.T) {
+	noBrowser(t)
+	p := newStubProvider(t)
+	out := make(urlWriter, 1)
+
+	go func() {
+		q := p.authorize(<-out)
+		res, err := http.Get(p.redirect + "?state=" + url.QueryEscape(q.Get("state")) + "&error=access_denied")
+		if err == nil {
+			res.Body.Close()
+		}
+	}()
+	_, err := LoopbackToken(context.Background(), p.config("http://127.0.0.1"), out, nil)
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Fatalf("LoopbackToken error = %v", err)
+	}
+}
+
+func TestPasteToken(t *testing.T) {
+	p := newStubProvider(t)
+	out := make(urlWriter, 1)
+	in, paste := io.Pipe()
+	defer paste.Close()
+
+	go func() {
+		p.authorize(<-out)
+		io.WriteString(paste, "the-code\n")
+	}()
+	tok, err := PasteToken(context.Background(), p.config("urn:ietf:wg:oauth:2.0:oob"), out, in)
+	if err != nil || tok.AccessToken != "access" {
+		t.Fatalf("PasteToken = %+v, %v", tok, err)
+	}
+}
+
+func TestDeviceToken(t *testing.T) {
+	p := newStubProvider(t)
+	out := &strings.Builder{}
+	tok, err := DeviceToken(context.Background(), p.config("http://127.0.0.1"), out)
+	if err != nil || tok.AccessToken != "device-access" || tok.RefreshToken != "refresh" {
+		t.Fatalf("DeviceToken = %+v, %v", tok, err)
+	}
+	if !strings.Contains(out.String(), p.URL+"/verify") || !strings.Contains(out.String(), "ABCD-EFGH") {
+		t.Errorf("device instructions = %q", out.String())
+	}
+	if p.polls != 2 {
+		t.Errorf("token polls = %d, want 2", p.polls)
+	}
+
+	cfg := p.config("http://127.0.0.1")
+	cfg.Endpoint.DeviceAuthURL = p.URL + "/token" // Not a device endpoint
+	if _, err := DeviceToken(context.Background(), cfg, out); err == nil {
+		t.Error("DeviceToken with a failing device endpoint should fail")
+	}
+}
+
+func TestPersistentTokenSource(t *testing.T) {
+	p := newStubProvider(t)
+	expired := func(refresh string) *oauth2.Token {
+		return &oauth2.Token{AccessToken: "old", RefreshToken: refresh, Expiry: time.Now().Add(-time.Hour)}
+	}
+
+	saved := []*oauth2.Token{}
+	save := func(tok *oauth2.Token) error {
+		saved = append(saved, tok)
+		return nil
+	}
+	ts := PersistentTokenSource(p.config(""), expired("refresh"), save, "reauth")
+	for i := 0; i < 2; i++ {
+		tok, err := ts.Token()
+		if err != nil || tok.AccessToken != "refreshed" {
+			t.Fatalf("Token = %+v, %v", tok, err)
+		}
+	}
+	if len(saved) != 1 || saved[0].AccessToken != "refreshed" {
+		t.Errorf("saved tokens = %+v", saved)
+	}
+
+	tests := []struct {
+		name string
+		tok  *oauth2.Token
+	}{
+		{"nil", nil},
+		{"no refresh", expired("")},
+		{"revoked", expired("revoked")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PersistentTokenSource(p.config(""), tt.tok, save, "reauth").Token()
+			if !errors.Is(err, ErrReauth) || !strings.Contains(err.Error(), "reauth") {
+				t.Errorf("Token error = %v, want ErrReauth", err)
+			}
+		})
+	}
+}
+
+func TestReadCode(t *testing.T) {
+	tests := []struct {
+		in   string
+		code string
+		err  bool
+	}{
+		{"abc\n", "abc", false},
+		{"\n  abc  \n", "abc", false},
+		{"http://127.0.0.1:1234/?state=s&code=abc\n", "abc", false},
+		{"http://127.0.0.1:1234/?state=x&code=abc\n", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		code, err := readCode(strings.NewReader(tt.in), "s")
+		if code != tt.code || (err != nil) != tt.err {
+			t.Errorf("readCode(%q) = %q, %v", tt.in, code, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package oauth2util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrReauth returned when the refresh token was revoked or expired
+var ErrReauth = errors.New("oauth2 token expired or revoked")
+
+// SaveFunc persists a refreshed token
+type SaveFunc func(tok *oauth2.Token) error
+
+// persistentTokenSource saves tokens when they are refreshed
+type persistentTokenSource struct {
+	mu     sync.Mutex
+	src    oauth2.TokenSource
+	last   *oauth2.Token
+	save   SaveFunc
+	reauth string
+}
+
+// PersistentTokenSource returns a TokenSource refreshing tok with config,
+// save is called for every new token, reauth tells the user how to
+// re-authenticate if the refresh token is no longer valid
+func PersistentTokenSource(config *oauth2.Config, tok *oauth2.Token, save SaveFunc, reauth string) oauth2.TokenSource {
+	return &persistentTokenSource{
+		src:    config.TokenSource(context.Background(), tok),
+		last:   tok,
+		save:   save,
+		reauth: reauth,
+	}
+}
+
+// Token returns a valid token, refreshing and saving it if needed
+func (ts *persistentTokenSource) Token() (*oauth2.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	tok, err := ts.src.Token()
+	if err != nil {
+		var rerr *oauth2.RetrieveError
+		ok := errors.As(err, &rerr)
+		if ts.last == nil || ts.last.RefreshToken == "" || ok && (rerr.ErrorCode == "invalid_grant" || rerr.Response != nil && rerr.Response.StatusCode == http.StatusUnauthorized) {
+			err = fmt.Errorf("%w, re-authenticate with: %s", ErrReauth, ts.reauth)
+			log.Println(err)
+		}
+		return nil, err
+	}
+	if ts.last == nil || tok.AccessToken != ts.last.AccessToken {
+		if err := ts.save(tok); err != nil {
+			log.Println("Unable to save refreshed token:", err)
+		}
+		ts.last = tok
+	}
+	return tok, nil
+}
@@ -11,13 +11,12 @@ import (
 	"os"
 
 	"github.com/gohxs/cloudmount/internal/core"
+	"github.com/gohxs/cloudmount/internal/coreutil"
 
 	"github.com/gohxs/cloudmount/internal/fs/dropboxfs"
 	"github.com/gohxs/cloudmount/internal/fs/gdrivefs"
 	"github.com/gohxs/cloudmount/internal/fs/megafs"
 	"github.com/gohxs/prettylog"
-
-	"os/exec"
 )
 
 var (
@@ -38,14 +37,24 @@ func main() {
 
 	prettylog.Global()
 
+	if len(os.Args) > 1 && os.Args[1] == "systemd-unit" {
+		os.Exit(systemdUnit(os.Args[2:]))
+	}
+
 	fmt.Fprintf(os.Stderr, "%s-%s\n", Name, Version)
 	// getClient
 	c := core.New()
 
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(ctl(&c.Config, os.Args[2:]))
+	}
+
 	// More will be added later
 	c.Drivers["gdrive"] = gdrivefs.New
 	c.Drivers["dropbox"] = dropboxfs.New
 	c.Drivers["mega"] = megafs.New
+	// Driver options, -o <driver>.<name>=value
+	c.Config.DriverOptions["gdrive"] = &gdrivefs.Options{}
 
 	if err := parseFlags(&c.Config); err != nil {
 		log.Fatalln(err)
@@ -53,8 +62,8 @@ func main() {
 
 	err := c.Init() // Before daemon, because might require interactivity
 	if err != nil {
-		log.Println("Err:", err)
-		return
+		coreutil.NotifyReady(err)
+		log.Fatalln("Err:", err)
 	}
 	fmt.Fprintf(os.Stderr, "%s on %s type %s\n", c.Config.Source, c.Config.Target, c.Config.Type)
 
@@ -62,23 +71,10 @@ func main() {
 	// Daemon
 	/////////////////
 	if !c.Config.Foreground {
-		subArgs := []string{"-f"}
-		for _, arg := range os.Args[1:] {
-			if arg == "-f" { // ignore daemon flag, already added
-				continue
-			}
-			subArgs = append(subArgs, arg)
-		}
-
-		cmd := exec.Command(os.Args[0], subArgs...)
-		//cmd.Stdout = os.Stdout
-		//cmd.Stderr = os.Stderr
-		cmd.Start()
-		fmt.Println("[PID]", cmd.Process.Pid)
-		os.Exit(0)
-		return
+		os.Exit(daemon(&c.Config))
 	}
 
-	c.Mount()
-
+	if err := c.Mount(); err != nil {
+		log.Fatalln("Err:", err)
+	}
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// mount(8) helper, installed as /sbin/mount.cloudmount[.<type>] and called as:
+//   mount.cloudmount <source> <directory> [-sfnv] [-o options] [-t type]
+// the workdir=<dir> option is passed as -w
+
+// mountHelperArgs converts mount(8) helper arguments to cloudmount flags,
+// fake is set on mount -f (nothing should be mounted)
+func mountHelperArgs(args []string) (ret []string, fake bool, err error) {
+	if len(args) < 2 {
+		return nil, false, errors.New("usage: mount.cloudmount <source> <directory> [-sfnv] [-o options]")
+	}
+	opts := []string{}
+	for i := 2; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-o" || arg == "-t":
+			if i+1 >= len(args) {
+				return nil, false, errors.New("missing value for " + arg)
+			}
+			i++
+			if arg == "-o" {
+				opts = append(opts, args[i])
+			} // type comes from the helper name or source
+		case strings.HasPrefix(arg, "-o"):
+			opts = append(opts, arg[2:])
+		case strings.HasPrefix(arg, "-"):
+			for _, c := range arg[1:] {
+				switch c {
+				case 'f': // fake
+					fake = true
+				case 'v':
+					ret = append(ret, "-v")
+				case 's', 'n': // sloppy, no mtab
+				default:
+					return nil, false, errors.New("unknown flag -" + string(c))
+				}
+			}
+		default:
+			return nil, false, errors.New("unexpected argument " + arg)
+		}
+	}
+	mountOpts := []string{}
+	for _, opt := range strings.Split(strings.Join(opts, ","), ",") {
+		if strings.HasPrefix(opt, "workdir=") {
+			ret = append(ret, "-w", strings.TrimPrefix(opt, "workdir="))
+			continue
+		}
+		if opt != "" {
+			mountOpts = append(mountOpts, opt)
+		}
+	}
+	if len(mountOpts) > 0 {
+		ret = append(ret, "-o", strings.Join(mountOpts, ","))
+	}
+	ret = append(ret, args[0], args[1])
+	return ret, fake, nil
+}
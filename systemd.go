@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gohxs/cloudmount/internal/coreutil"
+)
+
+// systemdUnit prints a systemd unit for a mount:
+//   cloudmount systemd-unit [-mount] [-o options] <remote|source> <directory>
+func systemdUnit(args []string) int {
+	fset := flag.NewFlagSet("systemd-unit", flag.ExitOnError)
+	mountUnit := fset.Bool("mount", false, "Print a .mount unit using the mount.cloudmount helper instead of a service")
+	opts := fset.String("o", "", "Mount options")
+	workDir := fset.String("w", "", "Work dir, path that holds configurations")
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s systemd-unit [options] <remote|source> <directory>\n\n", os.Args[0])
+		fset.PrintDefaults()
+	}
+	fset.Parse(args)
+	if fset.NArg() != 2 {
+		fset.Usage()
+		return 2
+	}
+
+	source := fset.Arg(0)
+	if _, err := os.Stat(source); err == nil { // Config file
+		source, _ = filepath.Abs(source)
+	} else if !strings.HasSuffix(source, ":") { // Named remote
+		source += ":"
+	}
+	target, err := filepath.Abs(fset.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERR:", err)
+		return 1
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERR:", err)
+		return 1
+	}
+
+	// User units are installed in ~/.config/systemd/user
+	wantedBy := "multi-user.target"
+	unitDir := "/etc/systemd/system"
+	if os.Getuid() != 0 {
+		wantedBy = "default.target"
+		unitDir = "~/.config/systemd/user"
+	}
+
+	if *mountUnit {
+		mountOpts := "_netdev"
+		if *workDir != "" {
+			mountOpts += ",workdir=" + *workDir
+		}
+		if *opts != "" {
+			mountOpts += "," + *opts
+		}
+		fmt.Printf("# %s/%s.mount, requires %s linked as /sbin/mount.cloudmount\n", unitDir, coreutil.EscapePath(target), exe)
+		fmt.Printf("[Unit]\nDescription=cloudmount %s on %s\nWants=network-online.target\nAfter=network-online.target\n\n", source, target)
+		fmt.Printf("[Mount]\nWhat=%s\nWhere=%s\nType=cloudmount\nOptions=%s\n\n", source, target, mountOpts)
+		fmt.Printf("[Install]\nWantedBy=remote-fs.target\n")
+		return 0
+	}
+
+	cmd := []string{exe, "-f"}
+	if *workDir != "" {
+		cmd = append(cmd, "-w", *workDir)
+	}
+	if *opts != "" {
+		cmd = append(cmd, "-o", *opts)
+	}
+	cmd = append(cmd, source, target)
+	for i, arg := range cmd {
+		cmd[i] = unitQuote(arg)
+	}
+
+	fmt.Printf("# %s/cloudmount-%s.service\n", unitDir, coreutil.EscapePath(target))
+	fmt.Printf("[Unit]\nDescription=cloudmount %s on %s\nWants=network-online.target\nAfter=network-online.target\n\n", source, target)
+	fmt.Printf("[Service]\nType=notify\nExecStart=%s\nExecStopPost=-/bin/fusermount -u %s\n", strings.Join(cmd, " "), unitQuote(target))
+	fmt.Printf("Restart=on-failure\nWatchdogSec=60\nTimeoutStartSec=300\n\n")
+	fmt.Printf("[Install]\nWantedBy=%s\n", wantedBy)
+	return 0
+}
+
+// unitQuote quotes a command line argument if needed
+func unitQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;$%") {
+		return arg
+	}
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg) // Specifiers and variables
+	return strconv.Quote(arg)
+}